@@ -1,7 +1,18 @@
 package bgen
 
+import "strings"
+
 type Allele string
 
 func (a Allele) String() string {
 	return string(a)
 }
+
+// JoinAlleles returns the alleles separated by commas.
+func JoinAlleles(alleles []Allele) string {
+	out := make([]string, len(alleles))
+	for i, a := range alleles {
+		out[i] = a.String()
+	}
+	return strings.Join(out, ",")
+}
@@ -0,0 +1,194 @@
+package bgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carbocation/genomisc"
+	"github.com/carbocation/pfx"
+)
+
+// Opener opens the object at path, including its scheme (e.g.,
+// "s3://bucket/key"), for random-access reading.
+type Opener func(ctx context.Context, path string) (genomisc.ReaderAtCloser, error)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]Opener{
+		"gs":    openGoogleStorage,
+		"http":  openHTTP,
+		"https": openHTTP,
+	}
+)
+
+// RegisterScheme makes Open use opener for paths of the form
+// scheme://... . It replaces any opener already registered for scheme,
+// including the built-in gs, http and https openers. Paths without a scheme
+// are always opened from the local filesystem.
+func RegisterScheme(scheme string, opener Opener) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+
+	schemes[strings.ToLower(scheme)] = opener
+}
+
+// pathScheme returns the scheme of path in lower case, or "" if it has none.
+func pathScheme(path string) string {
+	scheme, _, found := strings.Cut(path, "://")
+	if !found || scheme == "" {
+		return ""
+	}
+	for _, r := range scheme {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return ""
+		}
+	}
+
+	return strings.ToLower(scheme)
+}
+
+// openPath opens path with the opener registered for its scheme, or from the
+// local filesystem if it has none. Files with a scheme are wrapped in a
+// CachingReaderAt, since each of the many small reads made while parsing a
+// variant would otherwise be a separate request. Backends whose size cannot
+// be determined are left uncached.
+func openPath(ctx context.Context, path string, opts OpenOptions) (genomisc.ReaderAtCloser, error) {
+	if pathScheme(path) == "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		return file, nil
+	}
+
+	file, err := openBackend(ctx, path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	if _, isCached := file.(*CachingReaderAt); isCached {
+		return file, nil
+	}
+	cacheOpts := opts.Cache
+	if cacheOpts == (CacheOptions{}) {
+		cacheOpts = DefaultCacheOptions()
+	}
+	if cached, err := NewCachingReaderAt(file, cacheOpts); err == nil {
+		return cached, nil
+	}
+
+	return file, nil
+}
+
+// statPath returns the size and last write time of path, which may have a
+// scheme, without reading its contents.
+func statPath(ctx context.Context, path string) (int64, time.Time, error) {
+	if pathScheme(path) == "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, time.Time{}, pfx.Err(err)
+		}
+		return info.Size(), info.ModTime(), nil
+	}
+
+	src, err := openBackend(ctx, path)
+	if err != nil {
+		return 0, time.Time{}, pfx.Err(err)
+	}
+	defer src.Close()
+
+	return statReaderAt(src)
+}
+
+// openBackend opens path, which must have a scheme, with its registered
+// opener.
+func openBackend(ctx context.Context, path string) (genomisc.ReaderAtCloser, error) {
+	scheme := pathScheme(path)
+
+	schemesMu.RLock()
+	opener, exists := schemes[scheme]
+	schemesMu.RUnlock()
+	if !exists {
+		return nil, pfx.Err(fmt.Errorf("No backend is registered for the %s:// scheme of %s", scheme, path))
+	}
+
+	file, err := opener(ctx, path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return file, nil
+}
+
+// OpenReaderAt reads a bgen file of size bytes from r, for callers that
+// already hold a reader. If r is also an io.Closer, closing the BGEN closes
+// it.
+func OpenReaderAt(r io.ReaderAt, size int64) (*BGEN, error) {
+	b := &BGEN{
+		File: &sectionReaderAtCloser{
+			SectionReader: io.NewSectionReader(r, 0, size),
+			src:           r,
+		},
+	}
+
+	if err := populateBGENHeader(b); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return b, nil
+}
+
+// sectionReaderAtCloser adapts an io.ReaderAt of known size to
+// genomisc.ReaderAtCloser.
+type sectionReaderAtCloser struct {
+	*io.SectionReader
+	src io.ReaderAt
+}
+
+func (s *sectionReaderAtCloser) Close() error {
+	if closer, ok := s.src.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
+
+// fetchToTempFile copies the object at path, which must have a registered
+// scheme, into a new temporary file and returns that file's name. The caller
+// is responsible for removing it.
+func fetchToTempFile(ctx context.Context, path, pattern string) (string, error) {
+	src, err := openBackend(ctx, path)
+	if err != nil {
+		return "", pfx.Err(err)
+	}
+	defer src.Close()
+
+	size, _, err := statReaderAt(src)
+	if err != nil {
+		return "", pfx.Err(err)
+	}
+
+	dst, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", pfx.Err(err)
+	}
+
+	// Large buffers keep the number of ranged reads down. The writer is
+	// wrapped so that *os.File's ReadFrom does not substitute its own small
+	// buffer.
+	_, err = io.CopyBuffer(struct{ io.Writer }{dst}, io.NewSectionReader(src, 0, size), make([]byte, 4<<20))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", pfx.Err(err)
+	}
+
+	return dst.Name(), nil
+}
@@ -0,0 +1,118 @@
+package bgen
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/carbocation/genomisc"
+)
+
+func TestOpenHTTP(t *testing.T) {
+	var nRanges int
+	fileServer := http.FileServer(http.Dir(filepath.Dir(exampleBGENPath)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			nRanges++
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	local, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	remote, err := Open(srv.URL + "/" + filepath.Base(exampleBGENPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	compareProbabilities(t, local, remote, 0)
+
+	if nRanges == 0 {
+		t.Error("Expected the file to be read with Range requests")
+	}
+
+	size, err := remote.fileSize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(exampleBGENPath); size != info.Size() {
+		t.Errorf("Got size %d, expected %d", size, info.Size())
+	}
+
+	if _, err := Open(srv.URL + "/missing.bgen"); err == nil {
+		t.Error("Expected an error opening a missing object")
+	}
+}
+
+func TestOpenReaderAt(t *testing.T) {
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	b, err := OpenReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	compareProbabilities(t, local, b, 0)
+
+	if report, err := Validate(b); err != nil || !report.OK() {
+		t.Errorf("Validate: %v %v", err, report)
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var opened string
+	RegisterScheme("mem", func(ctx context.Context, path string) (genomisc.ReaderAtCloser, error) {
+		opened = path
+		return &sectionReaderAtCloser{SectionReader: newBytesSection(data)}, nil
+	})
+	defer func() {
+		schemesMu.Lock()
+		delete(schemes, "mem")
+		schemesMu.Unlock()
+	}()
+
+	b, err := Open("MEM://example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if opened != "MEM://example" || b.NVariants != 199 {
+		t.Errorf("Opened %q with %d variants", opened, b.NVariants)
+	}
+
+	if _, err := Open("nosuchscheme://example"); err == nil || !strings.Contains(err.Error(), "No backend is registered") {
+		t.Errorf("Expected an unregistered scheme error, got %v", err)
+	}
+}
+
+func newBytesSection(data []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+}
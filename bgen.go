@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/carbocation/genomisc"
@@ -38,6 +39,9 @@ type BGEN struct {
 	FlagHasSampleIDs bool
 	SamplesStart     uint32 // TODO: Make private, expose by method (if at all)?
 	VariantsStart    uint32 // TODO: Make private, expose by method (if at all)?
+
+	// ctx governs reads from File; nil means context.Background()
+	ctx context.Context
 }
 
 func (b *BGEN) Close() error {
@@ -47,22 +51,57 @@ func (b *BGEN) Close() error {
 // Open attempts to read a bgen file located at path. If successful, this
 // returns a new BGEN object. Otherwise, it returns an error. Note that *os.File
 // trivially satisfies genomisc.ReaderAtCloser, so an *os.File can be provided.
-// If the path starts with gs://, then we assume that this is a Google Storage
-// object and will attempt to read it with your default credentials.
+// If the path has a URL scheme, such as gs:// or https://, it is opened with
+// the Opener registered for that scheme (see RegisterScheme). Google Storage
+// objects are read with your default credentials.
 func Open(path string) (*BGEN, error) {
+	return OpenContext(context.Background(), path)
+}
+
+// OpenContext is like Open, but ctx governs opening the file and every later
+// read from it, including reads by VariantReaders and ReadSamples. Once ctx
+// is done, reads fail with its error.
+func OpenContext(ctx context.Context, path string) (*BGEN, error) {
+	return OpenWithOptions(ctx, path, OpenOptions{})
+}
+
+// OpenOptions controls OpenWithOptions.
+type OpenOptions struct {
+	// Cache configures the CachingReaderAt that wraps files with a URL
+	// scheme. If it is zero, DefaultCacheOptions is used.
+	Cache CacheOptions
+}
+
+// OpenWithOptions is like OpenContext, with options for how the file is
+// read.
+func OpenWithOptions(ctx context.Context, path string, opts OpenOptions) (*BGEN, error) {
 	b := &BGEN{
 		FilePath: path,
+		ctx:      ctx,
 	}
 
-	if strings.HasPrefix(path, "gs://") {
-		return OpenFromGoogleStorageWithContext(b, context.Background())
+	file, err := openPath(ctx, path, opts)
+	if err != nil {
+		return nil, pfx.Err(err)
 	}
+	b.File = file
 
-	file, err := os.Open(path)
+	err = populateBGENHeader(b)
 	if err != nil {
+		b.File.Close()
 		return nil, pfx.Err(err)
 	}
+
+	return b, nil
+}
+
+func OpenFromGoogleStorageWithContext(b *BGEN, ctx context.Context) (*BGEN, error) {
+	file, err := openGoogleStorage(ctx, b.FilePath)
+	if err != nil {
+		return nil, err
+	}
 	b.File = file
+	b.ctx = ctx
 
 	err = populateBGENHeader(b)
 	if err != nil {
@@ -72,19 +111,17 @@ func Open(path string) (*BGEN, error) {
 	return b, nil
 }
 
-func OpenFromGoogleStorageWithContext(b *BGEN, ctx context.Context) (*BGEN, error) {
+// openGoogleStorage is the Opener for gs:// paths.
+func openGoogleStorage(ctx context.Context, path string) (genomisc.ReaderAtCloser, error) {
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Detect the bucket and the path to the actual file
-	pathParts := strings.SplitN(strings.TrimPrefix(b.FilePath, "gs://"), "/", 2)
-	if len(pathParts) != 2 {
-		return nil, fmt.Errorf("Tried to split your google storage path into 2 parts, but got %d: %v", len(pathParts), pathParts)
+	bucketName, pathName, err := gsBucketObject(path)
+	if err != nil {
+		return nil, err
 	}
-	bucketName := pathParts[0]
-	pathName := pathParts[1]
 
 	// Open the bucket with default credentials
 	bkt := client.Bucket(bucketName)
@@ -97,14 +134,17 @@ func OpenFromGoogleStorageWithContext(b *BGEN, ctx context.Context) (*BGEN, erro
 		// nop for this type, and can be left nil
 	}
 
-	b.File = wrappedHandle
+	return wrappedHandle, nil
+}
 
-	err = populateBGENHeader(b)
-	if err != nil {
-		return nil, pfx.Err(err)
+// gsBucketObject splits a gs:// path into its bucket and object names.
+func gsBucketObject(path string) (string, string, error) {
+	pathParts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(pathParts) != 2 {
+		return "", "", fmt.Errorf("Tried to split your google storage path into 2 parts, but got %d: %v", len(pathParts), pathParts)
 	}
 
-	return b, nil
+	return pathParts[0], pathParts[1], nil
 }
 
 func populateBGENHeader(b *BGEN) error {
@@ -185,10 +225,51 @@ func populateBGENHeader(b *BGEN) error {
 }
 
 func (b *BGEN) parseAtOffsetWithBuffer(offset int64, buffer []byte) error {
-	_, err := b.File.ReadAt(buffer, offset)
+	_, err := readAtContext(b.context(), b.File, buffer, offset)
 	if err != nil {
 		return pfx.Err(err)
 	}
 
 	return nil
 }
+
+// fileSize returns the size in bytes of the underlying file, if it can be
+// determined.
+func (b *BGEN) fileSize() (int64, error) {
+	size, _, err := b.fileStat()
+	return size, err
+}
+
+// fileStat returns the size in bytes and the last modification time of the
+// underlying file, if they can be determined.
+func (b *BGEN) fileStat() (int64, time.Time, error) {
+	return statReaderAt(b.File)
+}
+
+// statReaderAt returns the size in bytes and the last modification time of
+// f, if they can be determined. Readers that report only a Size have a zero
+// modification time.
+func statReaderAt(f genomisc.ReaderAtCloser) (int64, time.Time, error) {
+	switch f := f.(type) {
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := f.Stat()
+		if err != nil {
+			return 0, time.Time{}, pfx.Err(err)
+		}
+		return info.Size(), info.ModTime(), nil
+	case *genomisc.GSReaderAtCloser:
+		attrs, err := f.Attrs(f.Context)
+		if err != nil {
+			return 0, time.Time{}, pfx.Err(err)
+		}
+		return attrs.Size, attrs.Updated, nil
+	case interface{ Size() int64 }:
+		var modTime time.Time
+		if m, ok := f.(interface{ ModTime() time.Time }); ok {
+			modTime = m.ModTime()
+		}
+		return f.Size(), modTime, nil
+	}
+
+	return 0, time.Time{}, pfx.Err(fmt.Errorf("Cannot determine the size of a %T", f))
+}
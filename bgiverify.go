@@ -0,0 +1,160 @@
+package bgen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/carbocation/pfx"
+)
+
+// VerifyOptions controls BGIIndex.Verify.
+type VerifyOptions struct {
+	// Fraction is the fraction of Variant rows, between 0 and 1, that are
+	// decoded from the BGEN file and compared with the index.
+	Fraction float64
+
+	// Seed seeds the choice of rows.
+	Seed int64
+}
+
+// Verify checks that the index describes b. If the index has metadata, the
+// file size and first thousand bytes are compared with the file, as is the
+// last write time of a local file. Then a random sample of Variant rows is
+// decoded at FileStartPosition, confirming that the chromosome, position,
+// rsID and alleles match and that SizeInBytes ends exactly where the next
+// block begins. Problems are reported in the same form as Validate, with Variant
+// set to the row number (in file order) or -1 for metadata problems.
+func (bgi *BGIIndex) Verify(b *BGEN, opts VerifyOptions) (*ValidationReport, error) {
+	if opts.Fraction < 0 || opts.Fraction > 1 {
+		return nil, pfx.Err(fmt.Errorf("Fraction must be between 0 and 1, got %f", opts.Fraction))
+	}
+
+	size, modTime, err := b.fileStat()
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	report := &ValidationReport{FileSize: size}
+
+	if err := bgi.verifyMetadata(b, size, modTime, report); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	vr := b.NewVariantReader()
+	i := 0
+	err = bgi.eachVariant(func(row VariantIndex) {
+		if rng.Float64() < opts.Fraction {
+			verifyVariantRow(vr, row, i, size, report)
+			report.NVariantsRead++
+		}
+		i++
+	})
+
+	return report, pfx.Err(err)
+}
+
+// eachVariant calls fn with every index row, in file order. Rows of a .bgi
+// file are streamed rather than loaded all at once.
+func (bgi *BGIIndex) eachVariant(fn func(VariantIndex)) error {
+	if bgi.compact != nil {
+		for _, row := range bgi.compact.allVariants() {
+			fn(row)
+		}
+		return nil
+	}
+
+	rows, err := bgi.DB.Queryx("SELECT * FROM Variant ORDER BY file_start_position ASC")
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer rows.Close()
+
+	var row VariantIndex
+	for rows.Next() {
+		if err := rows.StructScan(&row); err != nil {
+			return pfx.Err(err)
+		}
+		fn(row)
+	}
+
+	return pfx.Err(rows.Err())
+}
+
+func (bgi *BGIIndex) verifyMetadata(b *BGEN, size int64, modTime time.Time, report *ValidationReport) error {
+	meta := bgi.Metadata
+	if meta == nil || (meta.FileSize == 0 && meta.FirstThousandBytes == nil) {
+		// Not all index files have metadata
+		return nil
+	}
+
+	if int64(meta.FileSize) != size {
+		report.add(0, -1, "The index was built for a file of %d bytes, but this file has %d", meta.FileSize, size)
+	}
+
+	// The last write time only identifies a local file: a copy on gs:// or
+	// behind a URL has the time it was uploaded, not the time the index
+	// recorded
+	if indexed := time.Time(meta.LastWriteTime); pathScheme(b.FilePath) == "" && !modTime.IsZero() && indexed.Unix() != modTime.Unix() {
+		report.add(0, -1, "The index was built for a file last written at %s, but this file was last written at %s", indexed.UTC().Format(time.RFC3339), modTime.UTC().Format(time.RFC3339))
+	}
+
+	first := make([]byte, len(meta.FirstThousandBytes))
+	n, err := readAtContext(b.context(), b.File, first, 0)
+	if err != nil && err != io.EOF {
+		return pfx.Err(err)
+	}
+	if !bytes.Equal(first[:n], meta.FirstThousandBytes) {
+		report.add(0, -1, "The first %d bytes of the file do not match those recorded in the index", len(meta.FirstThousandBytes))
+	}
+
+	return nil
+}
+
+// verifyVariantRow decodes the variant that row points to and compares them.
+func verifyVariantRow(vr *VariantReader, row VariantIndex, idx int, size int64, report *ValidationReport) {
+	start := int64(row.FileStartPosition)
+	if start >= size {
+		report.add(start, idx, "The index row for %s points past the end of the file", row.RSID)
+		return
+	}
+
+	// Walk the length fields first, so that a stale row pointing into the
+	// middle of a block cannot trigger an enormous allocation.
+	blockSize, err := vr.variantBlockSize(start)
+	if err == nil && start+blockSize > size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		report.add(start, idx, "The index row for %s does not point to a readable variant: %s", row.RSID, err)
+		return
+	}
+
+	v, next, err := vr.parseVariantAtOffset(start)
+	if err != nil {
+		report.add(start, idx, "The index row for %s does not point to a readable variant: %s", row.RSID, err)
+		return
+	}
+
+	if v.Chromosome != row.Chromosome || v.Position != row.Position {
+		report.add(start, idx, "The index row is at %s:%d, but the variant is at %s:%d", row.Chromosome, row.Position, v.Chromosome, v.Position)
+	}
+	if v.RSID != row.RSID {
+		report.add(start, idx, "The index row has rsID %s, but the variant has %s", row.RSID, v.RSID)
+	}
+	if v.NAlleles != row.NAlleles {
+		report.add(start, idx, "The index row has %d alleles, but the variant has %d", row.NAlleles, v.NAlleles)
+	}
+	if len(v.Alleles) > 0 && v.Alleles[0] != row.Allele1 {
+		report.add(start, idx, "The index row has first allele %s, but the variant has %s", row.Allele1, v.Alleles[0])
+	}
+	if len(v.Alleles) > 1 && v.Alleles[1] != row.Allele2 {
+		report.add(start, idx, "The index row has second allele %s, but the variant has %s", row.Allele2, v.Alleles[1])
+	}
+
+	if end := start + int64(row.SizeInBytes); end != next {
+		report.add(start, idx, "The index row says the variant ends at %d, but the next block begins at %d", end, next)
+	}
+}
@@ -0,0 +1,103 @@
+package bgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBGIVerify(t *testing.T) {
+	bgi := exampleBGI(t)
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	report, err := bgi.Verify(b, VerifyOptions{Fraction: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.NVariantsRead != 199 {
+		t.Fatalf("Checked %d rows, found problems %v", report.NVariantsRead, report.Problems)
+	}
+
+	// An index for a different file must not verify
+	dir := t.TempDir()
+	otherPath := filepath.Join(dir, "other.bgen")
+	if err := Subset(b, otherPath, SubsetOptions{SampleIDs: []string{"sample_001"}}); err != nil {
+		t.Fatal(err)
+	}
+	other, err := OpenIndex(subsetIndexPath(otherPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	report, err = other.Verify(b, VerifyOptions{Fraction: 0.5, Seed: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.NVariantsRead == 0 || report.NVariantsRead == 199 {
+		t.Errorf("Expected about half the rows to be checked, got %d", report.NVariantsRead)
+	}
+	expectProblem(t, report, "was built for a file of")
+	expectProblem(t, report, "first 1000 bytes")
+	expectProblem(t, report, "does not point to a readable variant")
+}
+
+func TestBGIVerifyModTime(t *testing.T) {
+	requireSQLite(t)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.bgen")
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateBGI(path, path+".bgi"); err != nil {
+		t.Fatal(err)
+	}
+	bgi, err := OpenBGI(path + ".bgi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bgi.Close()
+
+	// The file is unchanged, but was written again later
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	report, err := bgi.Verify(b, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectProblem(t, report, "last written at")
+
+	// A remote copy has its upload time, which says nothing about whether
+	// the index is stale
+	srv, _ := flakyServer(t, dir, 0)
+	remote, err := Open(srv.URL + "/example.bgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	if report, err = bgi.Verify(remote, VerifyOptions{Fraction: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Errorf("Expected a remote copy of the file to verify, got problems %v", report.Problems)
+	}
+}
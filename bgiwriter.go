@@ -0,0 +1,229 @@
+package bgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/carbocation/pfx"
+	"github.com/jmoiron/sqlx"
+)
+
+// The schema used by bgenix, so that indexes we create can be read by other
+// tools.
+const bgiSchema = `
+CREATE TABLE Metadata (
+	filename TEXT NOT NULL,
+	file_size INT NOT NULL,
+	last_write_time INT NOT NULL,
+	first_1000_bytes BLOB NOT NULL,
+	index_creation_time INT NOT NULL
+);
+CREATE TABLE Variant (
+	chromosome TEXT NOT NULL,
+	position INT NOT NULL,
+	rsid TEXT NOT NULL,
+	number_of_alleles INT NOT NULL,
+	allele1 TEXT NOT NULL,
+	allele2 TEXT NULL,
+	file_start_position INT NOT NULL,
+	size_in_bytes INT NOT NULL,
+	PRIMARY KEY (chromosome, position, rsid, allele1, allele2, file_start_position)
+) WITHOUT ROWID;
+`
+
+// CreateBGI scans the BGEN file at bgenPath and writes a bgenix-style index
+// for it to bgiPath, replacing any existing file. A gs:// bgiPath is built
+// locally and then uploaded.
+func CreateBGI(bgenPath, bgiPath string) error {
+	if defaultSQLiteDriver() == "" {
+		return pfx.Err(errNoSQLite)
+	}
+	if err := checkWritablePath(bgiPath); err != nil {
+		return pfx.Err(err)
+	}
+
+	b, err := Open(bgenPath)
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer b.Close()
+
+	meta, err := bgiMetadataForFile(b)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	rows, err := scanVariantIndex(b)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeBGIPath(bgiPath, meta, rows))
+}
+
+// writeBGIPath writes a .bgi file to path. A gs:// path is built locally and
+// then uploaded.
+func writeBGIPath(path string, meta *BGIMetadata, rows []VariantIndex) error {
+	if pathScheme(path) == "" {
+		return pfx.Err(writeBGI(path, meta, rows))
+	}
+
+	// SQLite needs a local file, so build the index in a temporary directory
+	dir, err := os.MkdirTemp("", "bgen-bgi-*")
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "index.bgi")
+	if err := writeBGI(local, meta, rows); err != nil {
+		return pfx.Err(err)
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer f.Close()
+
+	return pfx.Err(uploadFrom(context.Background(), f, path))
+}
+
+// bgiMetadataForFile computes the Metadata row that describes the file
+// behind b.
+func bgiMetadataForFile(b *BGEN) (*BGIMetadata, error) {
+	size, modTime, err := b.fileStat()
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	first := make([]byte, 1000)
+	n, err := b.File.ReadAt(first, 0)
+	if err != nil && err != io.EOF {
+		return nil, pfx.Err(err)
+	}
+
+	return &BGIMetadata{
+		Filename:           filepath.Base(b.FilePath),
+		FileSize:           uint(size),
+		LastWriteTime:      Time(modTime),
+		FirstThousandBytes: first[:n],
+		IndexCreationTime:  Time(time.Now()),
+	}, nil
+}
+
+// bgiMetadataForWriter computes the Metadata row for the file that w wrote
+// to path, which is only stat'ed rather than read back.
+func bgiMetadataForWriter(w *Writer, path string) (*BGIMetadata, error) {
+	_, modTime, err := statPath(context.Background(), path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return &BGIMetadata{
+		Filename:           filepath.Base(path),
+		FileSize:           uint(w.offset),
+		LastWriteTime:      Time(modTime),
+		FirstThousandBytes: w.head,
+		IndexCreationTime:  Time(time.Now()),
+	}, nil
+}
+
+// scanVariantIndex walks every variant block in b and returns its index row,
+// decoding only the identifying fields of each variant.
+func scanVariantIndex(b *BGEN) ([]VariantIndex, error) {
+	vr := b.NewVariantReader()
+	offset := int64(vr.currentOffset)
+
+	rows := make([]VariantIndex, 0, b.NVariants)
+	for {
+		block, next, err := vr.rawVariantAtOffset(offset)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, pfx.Err(fmt.Errorf("Variant at offset %d: %w", offset, err))
+		}
+
+		v, _, err := variantIdentifiersFromBlock(block, b.FlagLayout)
+		if err != nil {
+			return nil, pfx.Err(fmt.Errorf("Variant at offset %d: %w", offset, err))
+		}
+
+		rows = append(rows, variantIndexFor(v, offset, next-offset))
+		offset = next
+	}
+
+	return rows, nil
+}
+
+func variantIndexFor(v *Variant, offset, size int64) VariantIndex {
+	row := VariantIndex{
+		Chromosome:        v.Chromosome,
+		Position:          v.Position,
+		RSID:              v.RSID,
+		NAlleles:          v.NAlleles,
+		FileStartPosition: uint(offset),
+		SizeInBytes:       uint(size),
+	}
+	if len(v.Alleles) > 0 {
+		row.Allele1 = v.Alleles[0]
+	}
+	if len(v.Alleles) > 1 {
+		row.Allele2 = v.Alleles[1]
+	}
+
+	return row
+}
+
+// writeBGI creates a new SQLite index at path containing meta and rows.
+func writeBGI(path string, meta *BGIMetadata, rows []VariantIndex) error {
+	driver := defaultSQLiteDriver()
+	if driver == "" {
+		return pfx.Err(errNoSQLite)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return pfx.Err(err)
+	}
+
+	db, err := sqlx.Connect(driver, sqliteFileURI(path))
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(bgiSchema); err != nil {
+		return pfx.Err(err)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer tx.Rollback()
+
+	if meta != nil {
+		_, err = tx.Exec("INSERT INTO Metadata (filename, file_size, last_write_time, first_1000_bytes, index_creation_time) VALUES (?, ?, ?, ?, ?)",
+			meta.Filename, meta.FileSize, time.Time(meta.LastWriteTime).Unix(), meta.FirstThousandBytes, time.Time(meta.IndexCreationTime).Unix())
+		if err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	stmt, err := tx.Preparex("INSERT INTO Variant (chromosome, position, rsid, number_of_alleles, allele1, allele2, file_start_position, size_in_bytes) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer stmt.Close()
+
+	for _, row := range rows {
+		if _, err := stmt.Exec(row.Chromosome, row.Position, row.RSID, row.NAlleles, string(row.Allele1), string(row.Allele2), row.FileStartPosition, row.SizeInBytes); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	return pfx.Err(tx.Commit())
+}
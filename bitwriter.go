@@ -0,0 +1,33 @@
+package bgen
+
+// bitWriter is the inverse of bitReader: it packs values of a fixed bit width
+// into a byte slice, least significant bit first.
+type bitWriter struct {
+	offset int
+	bytes  []byte
+	nybble int
+}
+
+func newBitWriter(bytes []byte, nybbleSize int) *bitWriter {
+	bw := &bitWriter{
+		bytes:  bytes,
+		nybble: nybbleSize,
+	}
+
+	return bw
+}
+
+func (bw *bitWriter) Write(value uint32) {
+	if bw.nybble == 8 && bw.offset%8 == 0 {
+		// Speed up the most common path
+		bw.bytes[bw.offset/8] = byte(value)
+		bw.offset += 8
+		return
+	}
+	for i := 0; i < bw.nybble; i++ {
+		if value&(1<<uint32(i)) != 0 {
+			bw.bytes[(bw.offset+i)/8] |= 1 << uint((bw.offset+i)%8)
+		}
+	}
+	bw.offset += bw.nybble
+}
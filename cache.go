@@ -0,0 +1,306 @@
+package bgen
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/carbocation/genomisc"
+	"github.com/carbocation/pfx"
+)
+
+// CacheOptions configures a CachingReaderAt. Zero fields take the values
+// from DefaultCacheOptions.
+type CacheOptions struct {
+	// BlockSize is the number of bytes fetched and cached as one unit.
+	BlockSize int64
+
+	// MaxBlocks is the number of blocks kept in the LRU cache.
+	MaxBlocks int
+
+	// ReadAhead is the number of extra blocks fetched, in the same request,
+	// when a miss follows on from the previous read.
+	ReadAhead int
+}
+
+// DefaultCacheOptions returns the options used by Open for files with a URL
+// scheme. Its BlockSize and MaxBlocks fill in zero fields of the options
+// given to NewCachingReaderAt.
+func DefaultCacheOptions() CacheOptions {
+	return CacheOptions{
+		BlockSize: 1 << 20,
+		MaxBlocks: 64,
+		ReadAhead: 3,
+	}
+}
+
+// CacheStats counts the activity of a CachingReaderAt. Hits and Misses are
+// counted per block looked up, and Fetches per request to the underlying
+// reader.
+type CacheStats struct {
+	Hits         int64
+	Misses       int64
+	Fetches      int64
+	BytesFetched int64
+}
+
+// HitRate is the fraction of block lookups served from the cache.
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// CachingReaderAt wraps a reader whose reads are expensive, such as an
+// object in remote storage, so that small nearby reads share one fetch of a
+// larger block. It is safe for concurrent use.
+type CachingReaderAt struct {
+	src     genomisc.ReaderAtCloser
+	size    int64
+	modTime time.Time
+	opts    CacheOptions
+
+	mu        sync.Mutex
+	blocks    map[int64]*list.Element
+	lru       *list.List // of *cachedBlock, most recently used first
+	lastBlock int64
+	stats     CacheStats
+
+	// offset is the position of the next Read
+	offset int64
+}
+
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+// NewCachingReaderAt wraps src, whose size must be determinable (as for
+// *os.File, Google Storage objects and the built-in HTTP reader).
+func NewCachingReaderAt(src genomisc.ReaderAtCloser, opts CacheOptions) (*CachingReaderAt, error) {
+	defaults := DefaultCacheOptions()
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = defaults.BlockSize
+	}
+	if opts.MaxBlocks <= 0 {
+		opts.MaxBlocks = defaults.MaxBlocks
+	}
+	if opts.ReadAhead < 0 {
+		return nil, pfx.Err(fmt.Errorf("ReadAhead must not be negative, got %d", opts.ReadAhead))
+	}
+
+	size, modTime, err := statReaderAt(src)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return &CachingReaderAt{
+		src:       src,
+		size:      size,
+		modTime:   modTime,
+		opts:      opts,
+		blocks:    make(map[int64]*list.Element),
+		lru:       list.New(),
+		lastBlock: -2,
+	}, nil
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *CachingReaderAt) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *CachingReaderAt) Size() int64 {
+	return c.size
+}
+
+func (c *CachingReaderAt) ModTime() time.Time {
+	return c.modTime
+}
+
+func (c *CachingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return c.ReadAtContext(context.Background(), p, off)
+}
+
+// ReadAtContext is like ReadAt, but passes ctx on to the underlying reader
+// for any blocks that must be fetched.
+func (c *CachingReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, pfx.Err(fmt.Errorf("Cannot read at negative offset %d", off))
+	}
+	if off >= c.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	end := off + int64(len(p))
+	if end > c.size {
+		end = c.size
+	}
+	first, last := off/c.opts.BlockSize, (end-1)/c.opts.BlockSize
+	blocks := make([][]byte, last-first+1)
+
+	c.mu.Lock()
+	sequential := first == c.lastBlock || first == c.lastBlock+1
+	c.lastBlock = last
+	for i := range blocks {
+		if elem, exists := c.blocks[first+int64(i)]; exists {
+			c.lru.MoveToFront(elem)
+			blocks[i] = elem.Value.(*cachedBlock).data
+			c.stats.Hits++
+		} else {
+			c.stats.Misses++
+		}
+	}
+	c.mu.Unlock()
+
+	// Fetch each run of missing blocks with one request. Only the final run
+	// can be extended by read-ahead.
+	for i := 0; i < len(blocks); {
+		if blocks[i] != nil {
+			i++
+			continue
+		}
+		j := i
+		for j < len(blocks) && blocks[j] == nil {
+			j++
+		}
+
+		fetchEnd := first + int64(j)
+		if j == len(blocks) && sequential {
+			fetchEnd = c.readAheadEnd(fetchEnd)
+		}
+
+		fetched, err := c.fetch(ctx, first+int64(i), fetchEnd)
+		if err != nil {
+			return 0, pfx.Err(err)
+		}
+		copy(blocks[i:j], fetched)
+
+		i = j
+	}
+
+	n := 0
+	for i, data := range blocks {
+		blockStart := (first + int64(i)) * c.opts.BlockSize
+		from := int64(0)
+		if i == 0 {
+			from = off - blockStart
+		}
+		n += copy(p[n:], data[from:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// readAheadEnd extends a fetch that would end before block end by up to
+// ReadAhead blocks, stopping at the end of the file or at a cached block.
+func (c *CachingReaderAt) readAheadEnd(end int64) int64 {
+	nBlocks := (c.size + c.opts.BlockSize - 1) / c.opts.BlockSize
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := 0; k < c.opts.ReadAhead && end < nBlocks; k++ {
+		if _, exists := c.blocks[end]; exists {
+			break
+		}
+		end++
+	}
+
+	return end
+}
+
+// fetch reads blocks [from, to) from the source in one request and caches
+// them.
+func (c *CachingReaderAt) fetch(ctx context.Context, from, to int64) ([][]byte, error) {
+	start := from * c.opts.BlockSize
+	stop := to * c.opts.BlockSize
+	if stop > c.size {
+		stop = c.size
+	}
+
+	buf := make([]byte, stop-start)
+	if n, err := readAtContext(ctx, c.src, buf, start); err != nil && !(err == io.EOF && n == len(buf)) {
+		return nil, pfx.Err(err)
+	}
+
+	out := make([][]byte, 0, to-from)
+	for k := from; k < to; k++ {
+		lo := (k - from) * c.opts.BlockSize
+		hi := lo + c.opts.BlockSize
+		if hi > int64(len(buf)) {
+			hi = int64(len(buf))
+		}
+		out = append(out, buf[lo:hi:hi])
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Fetches++
+	c.stats.BytesFetched += int64(len(buf))
+
+	for i, data := range out {
+		index := from + int64(i)
+		if elem, exists := c.blocks[index]; exists {
+			c.lru.MoveToFront(elem)
+			continue
+		}
+		c.blocks[index] = c.lru.PushFront(&cachedBlock{index: index, data: data})
+	}
+	for c.lru.Len() > c.opts.MaxBlocks {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.blocks, oldest.Value.(*cachedBlock).index)
+	}
+
+	return out, nil
+}
+
+func (c *CachingReaderAt) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	off := c.offset
+	c.mu.Unlock()
+
+	n, err := c.ReadAt(p, off)
+
+	c.mu.Lock()
+	c.offset += int64(n)
+	c.mu.Unlock()
+
+	return n, err
+}
+
+// Close releases the cached blocks and closes the underlying reader.
+func (c *CachingReaderAt) Close() error {
+	c.mu.Lock()
+	c.blocks = make(map[int64]*list.Element)
+	c.lru.Init()
+	c.mu.Unlock()
+
+	return c.src.Close()
+}
+
+// CacheStats reports the block cache counters of a file opened from a URL,
+// or false if the file is not cached.
+func (b *BGEN) CacheStats() (CacheStats, bool) {
+	if c, ok := b.File.(*CachingReaderAt); ok {
+		return c.Stats(), true
+	}
+
+	return CacheStats{}, false
+}
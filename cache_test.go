@@ -0,0 +1,152 @@
+package bgen
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// countingReaderAt counts the reads made of an in-memory file.
+type countingReaderAt struct {
+	*sectionReaderAtCloser
+	reads int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&c.reads, 1)
+	return c.sectionReaderAtCloser.ReadAt(p, off)
+}
+
+func TestCachingReaderAt(t *testing.T) {
+	data := make([]byte, 10000)
+	rng := rand.New(rand.NewSource(1))
+	rng.Read(data)
+
+	src := &countingReaderAt{sectionReaderAtCloser: &sectionReaderAtCloser{SectionReader: newBytesSection(data)}}
+	c, err := NewCachingReaderAt(src, CacheOptions{BlockSize: 100, MaxBlocks: 8, ReadAhead: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 0; i < 2000; i++ {
+		off := rng.Int63n(int64(len(data)))
+		buf := make([]byte, rng.Intn(350)+1)
+
+		n, err := c.ReadAt(buf, off)
+		want := data[off:]
+		if len(want) > len(buf) {
+			want = want[:len(buf)]
+		}
+		if n != len(want) || !bytes.Equal(buf[:n], want) {
+			t.Fatalf("ReadAt(%d bytes, %d) returned the wrong %d bytes", len(buf), off, n)
+		}
+		if n < len(buf) && err == nil {
+			t.Fatalf("ReadAt(%d bytes, %d) returned %d bytes without an error", len(buf), off, n)
+		}
+		if c.lru.Len() > 8 {
+			t.Fatalf("Cache holds %d blocks, expected at most 8", c.lru.Len())
+		}
+	}
+
+	stats := c.Stats()
+	if stats.Fetches != src.reads {
+		t.Errorf("Counted %d fetches, but the source saw %d reads", stats.Fetches, src.reads)
+	}
+	if stats.Hits == 0 || stats.Misses == 0 {
+		t.Errorf("Expected both hits and misses, got %+v", stats)
+	}
+}
+
+func TestCachingReaderAtReadAhead(t *testing.T) {
+	data := make([]byte, 10000)
+	src := &countingReaderAt{sectionReaderAtCloser: &sectionReaderAtCloser{SectionReader: newBytesSection(data)}}
+	c, err := NewCachingReaderAt(src, CacheOptions{BlockSize: 100, MaxBlocks: 8, ReadAhead: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read the file sequentially, ten bytes at a time. The first fetch
+	// is a lone block; every later miss fetches five blocks.
+	buf := make([]byte, 10)
+	for off := int64(0); off < int64(len(data)); off += 10 {
+		if _, err := c.ReadAt(buf, off); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stats := c.Stats(); stats.Fetches != 21 || stats.BytesFetched != int64(len(data)) {
+		t.Errorf("Got %+v, expected 21 fetches of %d bytes in total", stats, len(data))
+	}
+}
+
+func TestOpenHTTPCached(t *testing.T) {
+	var nGets, nBytes int64
+	fileServer := http.FileServer(http.Dir(filepath.Dir(exampleBGENPath)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt64(&nGets, 1)
+		}
+		fileServer.ServeHTTP(&countingResponseWriter{ResponseWriter: w, n: &nBytes}, r)
+	}))
+	defer srv.Close()
+
+	local, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	opts := OpenOptions{Cache: CacheOptions{BlockSize: 64 << 10, MaxBlocks: 4, ReadAhead: 2}}
+	remote, err := OpenWithOptions(context.Background(), srv.URL+"/"+filepath.Base(exampleBGENPath), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	compareProbabilities(t, local, remote, 0)
+
+	stats, cached := remote.CacheStats()
+	if !cached {
+		t.Fatal("Expected a remote file to be cached")
+	}
+	gets, served := atomic.LoadInt64(&nGets), atomic.LoadInt64(&nBytes)
+	if stats.Fetches != gets || stats.BytesFetched != served {
+		t.Errorf("Stats %+v do not match the %d GETs and %d bytes served", stats, gets, served)
+	}
+
+	info, err := os.Stat(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if served != info.Size() {
+		t.Errorf("Fetched %d bytes of a %d byte file, expected each byte once", served, info.Size())
+	}
+	// Each variant is now about one read, so the few misses that fetch a
+	// block weigh more than they did when every length field was a read
+	if stats.Misses > stats.Fetches || stats.HitRate() < 0.95 {
+		t.Errorf("Hit rate %f is unexpectedly low: %+v", stats.HitRate(), stats)
+	}
+
+	if _, cached := local.CacheStats(); cached {
+		t.Error("Expected a local file not to be cached")
+	}
+}
+
+// countingResponseWriter counts the body bytes written.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/carbocation/bgen"
+)
+
+func runCat(args []string) error {
+	fs, _ := newFlagSet("cat")
+	outPath := fs.String("out", "", "Filename of the bgen file to create, or - for stdout")
+	mergeSamples := fs.Bool("merge-samples", false, "Join files with disjoint samples over the same variants, instead of concatenating variants")
+	compression := fs.String("compression", "zstd", "With -merge-samples: none, zlib or zstd")
+	bits := fs.Int("bits", 16, "With -merge-samples: number of bits used to store each probability (1-32)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: bgen cat -out out.bgen in1.bgen in2.bgen ...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *outPath == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("-out and at least one input file are required")
+	}
+
+	inputs := make([]*bgen.BGEN, 0, fs.NArg())
+	for _, path := range fs.Args() {
+		b, err := openBGEN(path)
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+		inputs = append(inputs, b)
+	}
+
+	out, err := createOutput(*outPath)
+	if err != nil {
+		return err
+	}
+	defer abortOutput(out)
+
+	if *mergeSamples {
+		c, err := parseCompression(*compression)
+		if err != nil {
+			return err
+		}
+		nBits, err := parseBits(*bits)
+		if err != nil {
+			return err
+		}
+		err = bgen.MergeSamples(out, bgen.WriterOptions{
+			Layout:           bgen.Layout2,
+			Compression:      c,
+			NProbabilityBits: nBits,
+		}, inputs...)
+		if err != nil {
+			return err
+		}
+	} else if err := bgen.Concatenate(out, inputs...); err != nil {
+		return err
+	}
+
+	return out.Close()
+}
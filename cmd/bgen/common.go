@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/carbocation/bgen"
+)
+
+// newFlagSet returns a FlagSet for a subcommand, with the -bgen flag that
+// every subcommand shares.
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("bgen "+name, flag.ExitOnError)
+	path := fs.String("bgen", "", "Filename of the bgen file to process (local, gs:// or https://)")
+	return fs, path
+}
+
+func expandPath(path string) (string, error) {
+	if !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	usr, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(usr.HomeDir, path[2:]), nil
+}
+
+func openBGEN(path string) (*bgen.BGEN, error) {
+	if path == "" {
+		return nil, fmt.Errorf("-bgen is required")
+	}
+
+	path, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return bgen.Open(path)
+}
+
+// openSource opens path for a single pass from front to back, which is all
+// that some subcommands need. A path of "-" streams the file from stdin. The
+// returned BGEN holds the header and must be closed.
+func openSource(path string, lazy bool) (bgen.VariantSource, *bgen.BGEN, error) {
+	if path == "-" {
+		sr, err := bgen.NewStreamReader(os.Stdin)
+		if err != nil {
+			return nil, nil, err
+		}
+		sr.Lazy = lazy
+		return sr, sr.Header, nil
+	}
+
+	b, err := openBGEN(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	vr := b.NewVariantReader()
+	vr.Lazy = lazy
+
+	return vr, b, nil
+}
+
+// createOutput creates path, which may be a gs:// path, or returns stdout if
+// path is "-", in which case the bgen package streams its output instead of
+// seeking back to the header.
+func createOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return os.Stdout, nil
+	}
+
+	return bgen.CreateOutput(path)
+}
+
+// abortOutput abandons out, unless it has already been closed, so that an
+// error never publishes a partial gs:// upload.
+func abortOutput(out io.Closer) {
+	if a, ok := out.(interface{ Abort() }); ok {
+		a.Abort()
+		return
+	}
+	out.Close()
+}
+
+// openIndex opens idxPath, in either index format, or the bgen path plus .bgi
+// if idxPath is empty.
+func openIndex(bgenPath, idxPath string) (*bgen.BGIIndex, error) {
+	if idxPath == "" {
+		idxPath = bgenPath + ".bgi"
+	}
+
+	idxPath, err := expandPath(idxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return bgen.OpenIndex(idxPath)
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func readLines(path string) ([]string, error) {
+	path, err := expandPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			out = append(out, line)
+		}
+	}
+
+	return out, scanner.Err()
+}
+
+func parseCompression(s string) (bgen.Compression, error) {
+	switch s {
+	case "none":
+		return bgen.CompressionDisabled, nil
+	case "zlib":
+		return bgen.CompressionZLIB, nil
+	case "zstd":
+		return bgen.CompressionZStandard, nil
+	}
+
+	return 0, fmt.Errorf("Compression %q is not recognized; use none, zlib or zstd", s)
+}
+
+func parseLayout(n int) (bgen.Layout, error) {
+	switch n {
+	case 1:
+		return bgen.Layout1, nil
+	case 2:
+		return bgen.Layout2, nil
+	}
+
+	return 0, fmt.Errorf("Layout %d is not recognized; use 1 or 2", n)
+}
+
+func parseBits(n int) (uint8, error) {
+	if n < 1 || n > 32 {
+		return 0, fmt.Errorf("-bits must be 1-32 inclusive, got %d", n)
+	}
+
+	return uint8(n), nil
+}
+
+// readSamples returns the samples of b, naming them sample_1, sample_2 and
+// so on if the file has no sample identifier block.
+func readSamples(b *bgen.BGEN) ([]bgen.Sample, error) {
+	if b.FlagHasSampleIDs {
+		return bgen.ReadSamples(b)
+	}
+
+	samples := make([]bgen.Sample, b.NSamples)
+	for i := range samples {
+		samples[i].SampleID = fmt.Sprintf("sample_%d", i+1)
+	}
+
+	return samples, nil
+}
+
+// selectVariants resolves -region and -rsids flags into index rows, in file
+// order and with each variant once even if both flags match it. It returns
+// nil if neither was given, meaning every variant.
+func selectVariants(bgenPath, idxPath, region, rsidsPath string) ([]bgen.VariantIndex, error) {
+	if region == "" && rsidsPath == "" {
+		return nil, nil
+	}
+
+	bgi, err := openIndex(bgenPath, idxPath)
+	if err != nil {
+		return nil, err
+	}
+	defer bgi.Close()
+
+	rows := []bgen.VariantIndex{}
+
+	if region != "" {
+		r, err := bgen.ParseRegion(region)
+		if err != nil {
+			return nil, err
+		}
+		found, err := bgi.VariantsInRegion(r)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, found...)
+	}
+
+	if rsidsPath != "" {
+		rsids, err := readLines(rsidsPath)
+		if err != nil {
+			return nil, err
+		}
+		found, err := bgi.VariantsByRSID(rsids...)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, found...)
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].FileStartPosition < rows[j].FileStartPosition
+	})
+	unique := rows[:0]
+	for _, row := range rows {
+		if len(unique) == 0 || row.FileStartPosition != unique[len(unique)-1].FileStartPosition {
+			unique = append(unique, row)
+		}
+	}
+
+	return unique, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/carbocation/bgen"
+)
+
+func TestSelectVariants(t *testing.T) {
+	dir := t.TempDir()
+	idxPath := filepath.Join(dir, "example.bgen"+bgen.CompactIndexExtension)
+	if err := bgen.CreateCompactIndex(exampleBGENPath, idxPath); err != nil {
+		t.Fatal(err)
+	}
+
+	writeRSIDs := func(name string, rsids ...string) string {
+		path := filepath.Join(dir, name)
+		var text string
+		for _, rsid := range rsids {
+			text += rsid + "\n"
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	overlapping := writeRSIDs("overlapping.txt", "RSID_200", "RSID_3", "RSID_3", "missing")
+	disjoint := writeRSIDs("disjoint.txt", "RSID_200")
+
+	for _, test := range []struct {
+		name      string
+		region    string
+		rsidsPath string
+		want      []string
+		wantErr   bool
+	}{
+		{name: "neither flag", want: nil},
+		{name: "region", region: "01:2000-3000", want: []string{"RSID_2", "RSID_3", "RSID_102"}},
+		{name: "rsIDs", rsidsPath: overlapping, want: []string{"RSID_3", "RSID_200"}},
+		{name: "both, disjoint", region: "01:2000-3000", rsidsPath: disjoint, want: []string{"RSID_2", "RSID_3", "RSID_102", "RSID_200"}},
+		{name: "both, overlapping", region: "01:2000-3000", rsidsPath: overlapping, want: []string{"RSID_2", "RSID_3", "RSID_102", "RSID_200"}},
+		{name: "empty region", region: "02:1-100", want: []string{}},
+		{name: "invalid region", region: "01:3000-2000", wantErr: true},
+		{name: "missing rsID file", rsidsPath: filepath.Join(dir, "missing.txt"), wantErr: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rows, err := selectVariants(exampleBGENPath, idxPath, test.region, test.rsidsPath)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %d rows", len(rows))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (rows == nil) != (test.want == nil) {
+				t.Fatalf("Got rows %v, expected %v", rows, test.want)
+			}
+			if len(rows) != len(test.want) {
+				t.Fatalf("Got %d rows, expected %v", len(rows), test.want)
+			}
+			for i, row := range rows {
+				if row.RSID != test.want[i] {
+					t.Errorf("Row %d is %s, expected %s", i, row.RSID, test.want[i])
+				}
+				if i > 0 && row.FileStartPosition <= rows[i-1].FileStartPosition {
+					t.Errorf("Row %d at offset %d is not after row %d at %d", i, row.FileStartPosition, i-1, rows[i-1].FileStartPosition)
+				}
+			}
+		})
+	}
+}
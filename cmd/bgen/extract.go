@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"github.com/carbocation/bgen"
+)
+
+func runExtract(args []string) error {
+	fs, path := newFlagSet("extract")
+	idxPath := fs.String("bgi", "", "Filename of the bgi (index) file. Defaults to the bgen path plus .bgi")
+	region := fs.String("region", "", "Region to extract, as chr:start-end")
+	rsidsPath := fs.String("rsids", "", "File listing the rsIDs to extract, one per line")
+	format := fs.String("format", "vcf", "Output format: vcf, or tsv (one dosage column per sample; biallelic variants only)")
+	fs.Parse(args)
+
+	if *region == "" && *rsidsPath == "" {
+		return fmt.Errorf("-region or -rsids is required")
+	}
+	if *format != "vcf" && *format != "tsv" {
+		return fmt.Errorf("Format %q is not recognized; use vcf or tsv", *format)
+	}
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	rows, err := selectVariants(*path, *idxPath, *region, *rsidsPath)
+	if err != nil {
+		return err
+	}
+
+	samples, err := readSamples(b)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	if *format == "vcf" {
+		if err := bgen.WriteVCFHeader(w, samples); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprint(w, "CHROM\tPOS\tID\tRSID\tREF\tALT")
+		for _, s := range samples {
+			fmt.Fprintf(w, "\t%s", s.SampleID)
+		}
+		fmt.Fprintln(w)
+	}
+
+	vr := b.NewVariantReader()
+	var dosages []float64
+	for _, row := range rows {
+		v := vr.ReadIndexed(row)
+		if err := vr.Error(); err != nil {
+			return err
+		}
+
+		if *format == "vcf" {
+			if err := bgen.WriteVCFRecord(w, v); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if dosages, err = v.Dosages(dosages); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s", v.Chromosome, v.Position, v.ID, v.RSID, v.Alleles[0], v.Alleles[1])
+		for _, d := range dosages {
+			if math.IsNaN(d) {
+				fmt.Fprint(w, "\tNA")
+			} else {
+				fmt.Fprintf(w, "\t%s", strconv.FormatFloat(d, 'g', 6, 64))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	return nil
+}
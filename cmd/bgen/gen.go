@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/carbocation/bgen"
+)
+
+func runToGEN(args []string) error {
+	fs, path := newFlagSet("togen")
+	outPath := fs.String("out", "", "Filename of the GEN file to create; a .gz suffix gzips it")
+	samplePath := fs.String("sample", "", "Optional filename of an Oxford .sample file to create alongside it")
+	chromosomeColumn := fs.Bool("chromosome-column", false, "Start each line with the chromosome")
+	fs.Parse(args)
+
+	if *outPath == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	src, b, err := openSource(*path, false)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	n, err := bgen.WriteGEN(out, src, bgen.GENOptions{
+		ChromosomeColumn: *chromosomeColumn,
+		Gzip:             strings.HasSuffix(*outPath, ".gz"),
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if *samplePath != "" {
+		samples, err := readSamples(b)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(*samplePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := bgen.WriteSampleFile(f, samples); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Wrote %d variants\n", n)
+
+	return nil
+}
+
+func runFromGEN(args []string) error {
+	fs := flag.NewFlagSet("bgen fromgen", flag.ExitOnError)
+	genPath := fs.String("gen", "", "Filename of the GEN file to convert, optionally gzipped")
+	samplePath := fs.String("sample", "", "Optional filename of an Oxford .sample file with the sample IDs")
+	chromosome := fs.String("chromosome", "", "Chromosome for GEN files without a chromosome column")
+	outPath := fs.String("out", "", "Filename of the bgen file to create")
+	layout := fs.Int("layout", 2, "Output layout (1 or 2)")
+	compression := fs.String("compression", "zstd", "Output compression: none, zlib or zstd")
+	bits := fs.Int("bits", 16, "Number of bits used to store each probability (1-32)")
+	fs.Parse(args)
+
+	if *genPath == "" || *outPath == "" {
+		return fmt.Errorf("-gen and -out are required")
+	}
+
+	var opts bgen.WriterOptions
+	var err error
+	if opts.NProbabilityBits, err = parseBits(*bits); err != nil {
+		return err
+	}
+	if opts.Layout, err = parseLayout(*layout); err != nil {
+		return err
+	}
+	if opts.Compression, err = parseCompression(*compression); err != nil {
+		return err
+	}
+
+	gr, err := bgen.OpenGEN(*genPath, bgen.GENOptions{Chromosome: *chromosome})
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	if *samplePath != "" {
+		f, err := os.Open(*samplePath)
+		if err != nil {
+			return err
+		}
+		samples, err := bgen.ReadSampleFile(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if len(samples) != int(gr.NSamples) {
+			return fmt.Errorf("The sample file lists %d samples, but the GEN file has %d", len(samples), gr.NSamples)
+		}
+		for _, s := range samples {
+			opts.SampleIDs = append(opts.SampleIDs, s.SampleID)
+		}
+	}
+
+	w, err := bgen.Create(*outPath, gr.NSamples, opts)
+	if err != nil {
+		return err
+	}
+	defer w.Abort()
+
+	for v := gr.Read(); v != nil; v = gr.Read() {
+		if err := w.WriteVariant(v); err != nil {
+			return err
+		}
+	}
+	if err := gr.Error(); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	log.Printf("Wrote %d variants for %d samples\n", w.NVariants(), gr.NSamples)
+
+	return nil
+}
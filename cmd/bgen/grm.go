@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/carbocation/bgen"
+)
+
+func runGRM(args []string) error {
+	fs, path := newFlagSet("grm")
+	outPrefix := fs.String("out", "", "Prefix of the .grm.bin, .grm.N.bin and .grm.id files to create")
+	minMAF := fs.Float64("min-maf", 0.01, "Minimum minor allele frequency of the variants used")
+	maxMissing := fs.Float64("max-missing", 0, "Maximum fraction of missing samples per variant (0 disables the filter)")
+	fs.Parse(args)
+
+	if *outPrefix == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	samples, err := readSamples(b)
+	if err != nil {
+		return err
+	}
+
+	grm, err := bgen.ComputeGRM(b, bgen.GRMOptions{MinMAF: *minMAF, MaxMissingRate: *maxMissing})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Computed the GRM of %d samples from %d variants\n", grm.NSamples, grm.NVariants)
+
+	return grm.WriteGCTA(*outPrefix, samples)
+}
+
+func runPCA(args []string) error {
+	fs, path := newFlagSet("pca")
+	outPrefix := fs.String("out", "", "Prefix of the .eigenvec and .eigenval files to create")
+	nComponents := fs.Int("components", 10, "Number of principal components")
+	nIter := fs.Int("iter", 4, "Number of power iterations; each is a full pass over the file")
+	seed := fs.Int64("seed", 1, "Random seed")
+	minMAF := fs.Float64("min-maf", 0.01, "Minimum minor allele frequency of the variants used")
+	maxMissing := fs.Float64("max-missing", 0, "Maximum fraction of missing samples per variant (0 disables the filter)")
+	fs.Parse(args)
+
+	if *outPrefix == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	samples, err := readSamples(b)
+	if err != nil {
+		return err
+	}
+
+	result, err := bgen.RandomizedPCA(b, bgen.PCAOptions{
+		GRMOptions:  bgen.GRMOptions{MinMAF: *minMAF, MaxMissingRate: *maxMissing},
+		NComponents: *nComponents,
+		NIter:       *nIter,
+		Seed:        *seed,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := result.WriteFiles(*outPrefix, samples); err != nil {
+		return err
+	}
+
+	log.Printf("Computed %d components from %d variants\n", len(result.Eigenvalues), result.NVariants)
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/carbocation/bgen"
+)
+
+func runIndex(args []string) error {
+	fs, path := newFlagSet("index")
+	outPath := fs.String("out", "", "Filename of the index to create. Defaults to the bgen path plus .bgi, or .bgix with -format compact")
+	format := fs.String("format", "bgi", "Index format: bgi (SQLite, as used by bgenix) or compact (pure Go)")
+	fs.Parse(args)
+
+	bgenPath, err := expandPath(*path)
+	if err != nil {
+		return err
+	}
+
+	create := bgen.CreateBGI
+	extension := ".bgi"
+	switch *format {
+	case "bgi":
+	case "compact":
+		create = bgen.CreateCompactIndex
+		extension = bgen.CompactIndexExtension
+	default:
+		return fmt.Errorf("Unknown index format %q", *format)
+	}
+	if *outPath == "" {
+		*outPath = bgenPath + extension
+	}
+
+	if err := create(bgenPath, *outPath); err != nil {
+		return err
+	}
+
+	log.Println("Wrote", *outPath)
+
+	return nil
+}
+
+func runConvertIndex(args []string) error {
+	fs := flag.NewFlagSet("bgen convertindex", flag.ExitOnError)
+	inPath := fs.String("in", "", "Index to convert, in either format")
+	outPath := fs.String("out", "", "Filename of the index to create")
+	format := fs.String("format", "compact", "Output format: bgi or compact")
+	fs.Parse(args)
+
+	if *inPath == "" || *outPath == "" {
+		return fmt.Errorf("-in and -out are required")
+	}
+
+	in, err := expandPath(*inPath)
+	if err != nil {
+		return err
+	}
+
+	idx, err := bgen.OpenIndex(in)
+	if err != nil {
+		return err
+	}
+	defer idx.Close()
+
+	switch *format {
+	case "bgi":
+		err = idx.WriteBGI(*outPath)
+	case "compact":
+		err = idx.WriteCompactIndex(*outPath)
+	default:
+		err = fmt.Errorf("Unknown index format %q", *format)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Wrote", *outPath)
+
+	return nil
+}
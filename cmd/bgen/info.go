@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+)
+
+type infoOutput struct {
+	Path          string
+	NVariants     uint32
+	NSamples      uint32
+	Layout        string
+	Compression   string
+	HasSampleIDs  bool
+	SamplesStart  uint32
+	VariantsStart uint32
+}
+
+func runInfo(args []string) error {
+	fs, path := newFlagSet("info")
+	asJSON := fs.Bool("json", false, "Print JSON instead of text")
+	fs.Parse(args)
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	out := infoOutput{
+		Path:          b.FilePath,
+		NVariants:     b.NVariants,
+		NSamples:      b.NSamples,
+		Layout:        b.FlagLayout.String(),
+		Compression:   b.FlagCompression.String(),
+		HasSampleIDs:  b.FlagHasSampleIDs,
+		SamplesStart:  b.SamplesStart,
+		VariantsStart: b.VariantsStart,
+	}
+
+	if *asJSON {
+		return printJSON(out)
+	}
+
+	fmt.Printf("Path:           %s\n", out.Path)
+	fmt.Printf("Variants:       %d\n", out.NVariants)
+	fmt.Printf("Samples:        %d\n", out.NSamples)
+	fmt.Printf("Layout:         %s\n", out.Layout)
+	fmt.Printf("Compression:    %s\n", out.Compression)
+	fmt.Printf("Has sample IDs: %t\n", out.HasSampleIDs)
+	fmt.Printf("Samples start:  %d\n", out.SamplesStart)
+	fmt.Printf("Variants start: %d\n", out.VariantsStart)
+
+	return nil
+}
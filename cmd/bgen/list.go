@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/carbocation/bgen"
+)
+
+type listOutput struct {
+	ID         string
+	RSID       string
+	Chromosome string
+	Position   uint32
+	Alleles    []string
+}
+
+func runList(args []string) error {
+	fs, path := newFlagSet("list")
+	asJSON := fs.Bool("json", false, "Print one JSON object per line instead of TSV")
+	fs.Parse(args)
+
+	src, b, err := openSource(*path, true)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+
+	if !*asJSON {
+		fmt.Fprintln(w, "CHROM\tPOS\tID\tRSID\tALLELES")
+	}
+
+	// Lazy reads leave the genotypes undecoded, and Release hands their
+	// buffers straight back
+	for v := src.Read(); v != nil; v = src.Read() {
+		v.Release()
+		if *asJSON {
+			out := listOutput{ID: v.ID, RSID: v.RSID, Chromosome: v.Chromosome, Position: v.Position}
+			for _, a := range v.Alleles {
+				out.Alleles = append(out.Alleles, a.String())
+			}
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", v.Chromosome, v.Position, v.ID, v.RSID, bgen.JoinAlleles(v.Alleles))
+	}
+
+	return src.Error()
+}
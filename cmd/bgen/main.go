@@ -0,0 +1,87 @@
+// bgen is a command-line tool for inspecting, indexing, validating and
+// converting BGEN files. Run it without arguments to list its subcommands.
+// Paths with a gs://, http:// or https:// scheme are read remotely. The list,
+// togen and pgen subcommands also accept -bgen - to read a stream from stdin,
+// such as the output of gsutil cat or zcat.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+type subcommand struct {
+	summary string
+	run     func(args []string) error
+}
+
+var subcommands = map[string]subcommand{
+	"info":         {"Print header flags, counts, layout and compression", runInfo},
+	"samples":      {"Print sample IDs", runSamples},
+	"list":         {"Print variant metadata", runList},
+	"extract":      {"Extract variants by region or rsID as VCF or TSV", runExtract},
+	"index":        {"Create a .bgi or compact index", runIndex},
+	"convertindex": {"Convert an index between the .bgi and compact formats", runConvertIndex},
+	"validate":     {"Check a file (and optionally its index) for structural problems", runValidate},
+	"stats":        {"Print per-variant allele frequency, missingness and info", runStats},
+	"cat":          {"Concatenate files, or merge files with disjoint samples", runCat},
+	"subset":       {"Write a new file with a subset of samples and variants", runSubset},
+	"transcode":    {"Re-encode with a different layout, compression or bit depth", runTranscode},
+	"togen":        {"Convert to an Oxford GEN file", runToGEN},
+	"fromgen":      {"Convert an Oxford GEN file to bgen", runFromGEN},
+	"pgen":         {"Convert to a PLINK 2 .pgen/.pvar/.psam fileset with dosages", runPGEN},
+	"grm":          {"Compute a GCTA-format genetic relationship matrix", runGRM},
+	"pca":          {"Compute principal components by randomized PCA", runPCA},
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("bgen: ")
+
+	os.Exit(run(os.Args[1:]))
+}
+
+// run runs the subcommand named by args[0] and returns the exit status: 0 on
+// success, 1 on an error or when validate finds problems, and 2 if no
+// subcommand was given.
+func run(args []string) int {
+	if len(args) < 1 {
+		usage()
+		return 2
+	}
+
+	cmd, exists := subcommands[args[0]]
+	if !exists {
+		usage()
+		log.Printf("Unknown subcommand %q\n", args[0])
+		return 1
+	}
+
+	if err := cmd.run(args[1:]); errors.Is(err, errProblemsFound) {
+		// The problems have already been printed
+		return 1
+	} else if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	return 0
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: bgen <subcommand> [flags]")
+	fmt.Fprintln(os.Stderr, "Subcommands:")
+
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, subcommands[name].summary)
+	}
+	fmt.Fprintln(os.Stderr, "Run 'bgen <subcommand> -h' for the flags of a subcommand.")
+}
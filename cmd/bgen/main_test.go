@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const exampleBGENPath = "../../example/limix/example.bgen"
+
+// truncatedExample writes the first part of the example file, which cuts
+// its variants short.
+func truncatedExample(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "truncated.bgen")
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRunExitStatus(t *testing.T) {
+	truncated := truncatedExample(t)
+	out := filepath.Join(t.TempDir(), "out.bgen")
+
+	for _, test := range []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no subcommand", nil, 2},
+		{"unknown subcommand", []string{"nonexistent"}, 1},
+		{"valid file", []string{"validate", "-bgen", exampleBGENPath}, 0},
+		{"file with problems", []string{"validate", "-bgen", truncated}, 1},
+		{"file with problems as JSON", []string{"validate", "-bgen", truncated, "-json"}, 1},
+		{"missing file", []string{"validate", "-bgen", filepath.Join(t.TempDir(), "missing.bgen")}, 1},
+		{"bit depth", []string{"transcode", "-bgen", exampleBGENPath, "-out", out, "-bits", "8"}, 0},
+		{"bit depth too large", []string{"transcode", "-bgen", exampleBGENPath, "-out", out, "-bits", "33"}, 1},
+		{"bit depth truncated by uint8", []string{"transcode", "-bgen", exampleBGENPath, "-out", out, "-bits", "264"}, 1},
+		{"zero bit depth", []string{"fromgen", "-gen", exampleBGENPath, "-out", out, "-bits", "0"}, 1},
+		{"negative bit depth", []string{"cat", "-merge-samples", "-out", out, "-bits", "-1", exampleBGENPath}, 1},
+		{"subset with the input bit depth", []string{"subset", "-bgen", exampleBGENPath, "-out", out, "-bits", "0"}, 0},
+		{"subset bit depth too large", []string{"subset", "-bgen", exampleBGENPath, "-out", out, "-bits", "40"}, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := run(test.args); got != test.want {
+				t.Errorf("run(%q) = %d, expected %d", test.args, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/carbocation/bgen"
+)
+
+func runPGEN(args []string) error {
+	fs, path := newFlagSet("pgen")
+	outPrefix := fs.String("out", "", "Prefix of the .pgen, .pvar and .psam files to create")
+	threshold := fs.Float64("hard-call-threshold", bgen.DefaultPGENHardCallThreshold, "Largest distance from a whole-number dosage for which a hard call is saved")
+	asJSON := fs.Bool("json", false, "Print the export statistics as JSON")
+	fs.Parse(args)
+
+	if *outPrefix == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	src, b, err := openSource(*path, false)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	samples, err := readSamples(b)
+	if err != nil {
+		return err
+	}
+
+	stats, err := bgen.ExportPGEN(src, b.NSamples, samples, *outPrefix, bgen.PGENOptions{HardCallThreshold: threshold})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(stats)
+	}
+
+	log.Printf("Wrote %d variants; skipped %d multi-allelic variants\n", stats.NVariants, stats.NSkippedMultiallelic)
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/carbocation/bgen"
+)
+
+func runSamples(args []string) error {
+	fs, path := newFlagSet("samples")
+	asJSON := fs.Bool("json", false, "Print a JSON array instead of one ID per line")
+	fs.Parse(args)
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	samples, err := bgen.ReadSamples(b)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		ids := make([]string, len(samples))
+		for i, s := range samples {
+			ids[i] = s.SampleID
+		}
+		return printJSON(ids)
+	}
+
+	for _, s := range samples {
+		fmt.Println(s.SampleID)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+
+	"github.com/carbocation/bgen"
+)
+
+type statsOutput struct {
+	RSID            string
+	Chromosome      string
+	Position        uint32
+	NMissing        int
+	AlleleFrequency *float64
+	MAF             *float64
+	Info            *float64
+}
+
+func runStats(args []string) error {
+	fs, path := newFlagSet("stats")
+	idxPath := fs.String("bgi", "", "Filename of the bgi (index) file. Defaults to the bgen path plus .bgi")
+	region := fs.String("region", "", "Optional region, as chr:start-end")
+	rsidsPath := fs.String("rsids", "", "Optional file listing rsIDs, one per line")
+	asJSON := fs.Bool("json", false, "Print one JSON object per line instead of TSV")
+	fs.Parse(args)
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	rows, err := selectVariants(*path, *idxPath, *region, *rsidsPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	enc := json.NewEncoder(w)
+
+	if !*asJSON {
+		fmt.Fprintln(w, "CHROM\tPOS\tRSID\tN_MISSING\tALT_FREQ\tMAF\tINFO")
+	}
+
+	// Variants without stats, such as multi-allelic or phased ones, are
+	// skipped with a warning rather than ending the run partway through
+	emit := func(v *bgen.Variant) error {
+		stats, err := bgen.ComputeVariantStats(v)
+		if err != nil {
+			log.Printf("Skipping %s:%d %s: %v\n", v.Chromosome, v.Position, v.RSID, err)
+			return nil
+		}
+
+		if *asJSON {
+			// JSON cannot represent NaN
+			return enc.Encode(statsOutput{
+				RSID:            v.RSID,
+				Chromosome:      v.Chromosome,
+				Position:        v.Position,
+				NMissing:        stats.NMissing,
+				AlleleFrequency: finiteOrNil(stats.AlleleFrequency),
+				MAF:             finiteOrNil(stats.MAF),
+				Info:            finiteOrNil(stats.Info),
+			})
+		}
+
+		_, err = fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%g\t%g\t%g\n", v.Chromosome, v.Position, v.RSID, stats.NMissing, stats.AlleleFrequency, stats.MAF, stats.Info)
+		return err
+	}
+
+	vr := b.NewVariantReader()
+
+	if rows != nil {
+		for _, row := range rows {
+			v := vr.ReadIndexed(row)
+			if err := vr.Error(); err != nil {
+				return err
+			}
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		if err := emit(v); err != nil {
+			return err
+		}
+	}
+
+	return vr.Error()
+}
+
+func finiteOrNil(x float64) *float64 {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return nil
+	}
+	return &x
+}
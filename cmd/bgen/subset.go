@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/carbocation/bgen"
+)
+
+func runSubset(args []string) error {
+	fs, path := newFlagSet("subset")
+	idxPath := fs.String("bgi", "", "Filename of the bgi (index) file. Defaults to the bgen path plus .bgi")
+	outPath := fs.String("out", "", "Filename of the bgen file to create")
+	samplesPath := fs.String("samples", "", "Optional file listing the sample IDs to keep, one per line")
+	region := fs.String("region", "", "Optional region to keep, as chr:start-end")
+	rsidsPath := fs.String("rsids", "", "Optional file listing the rsIDs to keep, one per line")
+	bits := fs.Int("bits", 0, "Number of bits used to store each probability if samples are removed, 1-32 (default: each variant's bit depth in the input)")
+	fs.Parse(args)
+
+	if *outPath == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var opts bgen.SubsetOptions
+	if *bits != 0 {
+		if opts.NProbabilityBits, err = parseBits(*bits); err != nil {
+			return err
+		}
+	}
+
+	if *samplesPath != "" {
+		if opts.SampleIDs, err = readLines(*samplesPath); err != nil {
+			return err
+		}
+	}
+
+	if opts.Variants, err = selectVariants(*path, *idxPath, *region, *rsidsPath); err != nil {
+		return err
+	}
+	if opts.Variants != nil {
+		log.Println("Selected", len(opts.Variants), "variants")
+	}
+
+	return bgen.Subset(b, *outPath, opts)
+}
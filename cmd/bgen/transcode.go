@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/carbocation/bgen"
+)
+
+func runTranscode(args []string) error {
+	fs, path := newFlagSet("transcode")
+	outPath := fs.String("out", "", "Filename of the bgen file to create, or - for stdout")
+	layout := fs.Int("layout", 2, "Output layout (1 or 2)")
+	compression := fs.String("compression", "zstd", "Output compression: none, zlib or zstd")
+	bits := fs.Int("bits", 16, "Number of bits used to store each probability (1-32)")
+	asJSON := fs.Bool("json", false, "Print the transcoding statistics as JSON")
+	fs.Parse(args)
+
+	if *outPath == "" {
+		return fmt.Errorf("-out is required")
+	}
+	if *outPath == "-" && *asJSON {
+		return fmt.Errorf("-json cannot be combined with -out -, since both write to stdout")
+	}
+
+	var opts bgen.WriterOptions
+	var err error
+	if opts.NProbabilityBits, err = parseBits(*bits); err != nil {
+		return err
+	}
+	if opts.Layout, err = parseLayout(*layout); err != nil {
+		return err
+	}
+	if opts.Compression, err = parseCompression(*compression); err != nil {
+		return err
+	}
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	out, err := createOutput(*outPath)
+	if err != nil {
+		return err
+	}
+	defer abortOutput(out)
+
+	stats, err := bgen.Transcode(b, out, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(stats)
+	}
+
+	log.Printf("Transcoded %d variants; the largest per-probability error introduced was %g\n", stats.NVariants, stats.MaxProbabilityError)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/carbocation/bgen"
+)
+
+// errProblemsFound is returned by runValidate when the file or index has
+// problems, which have already been printed, so main exits with status 1
+// without logging anything more.
+var errProblemsFound = errors.New("Problems were found")
+
+type validateOutput struct {
+	OK            bool
+	FileSize      int64
+	NVariants     uint32
+	NVariantsRead int
+	Problems      []bgen.ValidationProblem
+	Index         *bgen.ValidationReport `json:",omitempty"`
+}
+
+func runValidate(args []string) error {
+	fs, path := newFlagSet("validate")
+	idxPath := fs.String("bgi", "", "Optional index to cross-check against the bgen file")
+	fraction := fs.Float64("fraction", 1, "With -bgi: fraction of index rows to decode and compare")
+	asJSON := fs.Bool("json", false, "Print JSON instead of text")
+	fs.Parse(args)
+
+	b, err := openBGEN(*path)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	report, err := bgen.Validate(b)
+	if err != nil {
+		return err
+	}
+
+	out := validateOutput{
+		OK:            report.OK(),
+		FileSize:      report.FileSize,
+		NVariants:     b.NVariants,
+		NVariantsRead: report.NVariantsRead,
+		Problems:      report.Problems,
+	}
+
+	if *idxPath != "" {
+		bgi, err := openIndex(*path, *idxPath)
+		if err != nil {
+			return err
+		}
+		defer bgi.Close()
+
+		if out.Index, err = bgi.Verify(b, bgen.VerifyOptions{Fraction: *fraction}); err != nil {
+			return err
+		}
+		out.OK = out.OK && out.Index.OK()
+	}
+
+	if *asJSON {
+		if err := printJSON(out); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range out.Problems {
+			fmt.Println(problem)
+		}
+		log.Printf("Checked %d of %d declared variants in %d bytes; found %d problems\n", out.NVariantsRead, out.NVariants, out.FileSize, len(out.Problems))
+
+		if out.Index != nil {
+			for _, problem := range out.Index.Problems {
+				fmt.Println("index:", problem)
+			}
+			log.Printf("Checked %d index rows; found %d problems\n", out.Index.NVariantsRead, len(out.Index.Problems))
+		}
+	}
+
+	if !out.OK {
+		return errProblemsFound
+	}
+
+	return nil
+}
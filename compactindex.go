@@ -0,0 +1,428 @@
+package bgen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/carbocation/pfx"
+)
+
+// A compact index holds the same Metadata and Variant rows as a .bgi file,
+// in a small binary format that is read and written in pure Go, so that
+// tools built with the nosqlite tag can still query by region and rsID. It
+// starts with compactIndexMagic, followed by an optional metadata record and
+// then the rows grouped by chromosome and sorted by position and offset.
+// Integers are varints, and positions are delta-encoded within each
+// chromosome.
+const compactIndexMagic = "BGENCIX\x01"
+
+// CompactIndexExtension is the conventional suffix of compact index files.
+const CompactIndexExtension = ".bgix"
+
+// compactIndex is a compact index held in memory.
+type compactIndex struct {
+	// rows are sorted by chromosome, position and then file offset.
+	rows []VariantIndex
+}
+
+// CreateCompactIndex scans the BGEN file at bgenPath and writes a compact
+// index for it to idxPath, which may be a gs:// path.
+func CreateCompactIndex(bgenPath, idxPath string) error {
+	if err := checkWritablePath(idxPath); err != nil {
+		return pfx.Err(err)
+	}
+
+	b, err := Open(bgenPath)
+	if err != nil {
+		return pfx.Err(err)
+	}
+	defer b.Close()
+
+	meta, err := bgiMetadataForFile(b)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	rows, err := scanVariantIndex(b)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeCompactIndexPath(idxPath, meta, rows))
+}
+
+// OpenCompactIndex reads the compact index at path into memory. The result
+// answers the same queries as an index opened with OpenBGI, but its DB is
+// nil.
+func OpenCompactIndex(path string) (*BGIIndex, error) {
+	data, err := readWholePath(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	bgi, err := decodeCompactIndex(data)
+	if err != nil {
+		return nil, pfx.Err(fmt.Errorf("%s: %w", path, err))
+	}
+
+	return bgi, nil
+}
+
+// readWholePath reads all of path, which may have a scheme.
+func readWholePath(path string) ([]byte, error) {
+	if pathScheme(path) == "" {
+		return os.ReadFile(path)
+	}
+
+	src, err := openBackend(context.Background(), path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	size, _, err := statReaderAt(src)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(io.NewSectionReader(src, 0, size))
+}
+
+// OpenIndex opens the index at path, which may be either a .bgi file or a
+// compact index, telling them apart by their contents.
+func OpenIndex(path string) (*BGIIndex, error) {
+	path, cleanup, err := localIndexPath(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	defer func() {
+		if cleanup != nil {
+			cleanup()
+		}
+	}()
+
+	compact, err := isCompactIndex(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	if compact {
+		return OpenCompactIndex(path)
+	}
+
+	bgi, err := OpenBGI(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	// OpenBGI does not know that path is a temporary copy, so hand over its
+	// removal
+	bgi.cleanup, cleanup = cleanup, nil
+
+	return bgi, nil
+}
+
+func isCompactIndex(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(compactIndexMagic))
+	if _, err := io.ReadFull(f, magic); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return string(magic) == compactIndexMagic, nil
+}
+
+// WriteCompactIndex writes the rows and metadata of b, whichever format it
+// was opened from, to path as a compact index.
+func (b *BGIIndex) WriteCompactIndex(path string) error {
+	rows, err := b.AllVariants()
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeCompactIndexPath(path, b.metadata(), rows))
+}
+
+// WriteBGI writes the rows and metadata of b, whichever format it was opened
+// from, to path as a bgenix-style .bgi file.
+func (b *BGIIndex) WriteBGI(path string) error {
+	rows, err := b.AllVariants()
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeBGIPath(path, b.metadata(), rows))
+}
+
+// metadata returns b.Metadata, or nil if the index had none.
+func (b *BGIIndex) metadata() *BGIMetadata {
+	if b.Metadata == nil || (b.Metadata.Filename == "" && b.Metadata.FileSize == 0) {
+		return nil
+	}
+
+	return b.Metadata
+}
+
+func writeCompactIndexPath(path string, meta *BGIMetadata, rows []VariantIndex) error {
+	dst, err := createPath(context.Background(), path)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	if err := writeCompactIndex(dst, meta, rows); err != nil {
+		closeOrAbort(dst)
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(dst.Close())
+}
+
+func writeCompactIndex(w io.Writer, meta *BGIMetadata, rows []VariantIndex) error {
+	sorted := append([]VariantIndex(nil), rows...)
+	sortCompactRows(sorted)
+
+	e := &compactEncoder{w: bufio.NewWriter(w)}
+	e.w.WriteString(compactIndexMagic)
+
+	if meta == nil {
+		e.uvarint(0)
+	} else {
+		e.uvarint(1)
+		e.string(meta.Filename)
+		e.uvarint(uint64(meta.FileSize))
+		e.varint(time.Time(meta.LastWriteTime).Unix())
+		e.string(string(meta.FirstThousandBytes))
+		e.varint(time.Time(meta.IndexCreationTime).Unix())
+	}
+
+	e.uvarint(uint64(len(sorted)))
+	for start := 0; start < len(sorted); {
+		end := start + 1
+		for end < len(sorted) && sorted[end].Chromosome == sorted[start].Chromosome {
+			end++
+		}
+
+		e.string(sorted[start].Chromosome)
+		e.uvarint(uint64(end - start))
+		var position uint32
+		for _, row := range sorted[start:end] {
+			e.uvarint(uint64(row.Position - position))
+			position = row.Position
+			e.uvarint(uint64(row.FileStartPosition))
+			e.uvarint(uint64(row.SizeInBytes))
+			e.string(row.RSID)
+			e.uvarint(uint64(row.NAlleles))
+			e.string(string(row.Allele1))
+			e.string(string(row.Allele2))
+		}
+
+		start = end
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	return e.w.Flush()
+}
+
+func decodeCompactIndex(data []byte) (*BGIIndex, error) {
+	if !bytes.HasPrefix(data, []byte(compactIndexMagic)) {
+		return nil, fmt.Errorf("Not a compact index")
+	}
+	d := &compactDecoder{data: data[len(compactIndexMagic):]}
+
+	bgi := &BGIIndex{Metadata: &BGIMetadata{}, compact: &compactIndex{}}
+	if d.uvarint() == 1 {
+		bgi.Metadata.Filename = d.string()
+		bgi.Metadata.FileSize = uint(d.uvarint())
+		bgi.Metadata.LastWriteTime = Time(time.Unix(d.varint(), 0))
+		bgi.Metadata.FirstThousandBytes = []byte(d.string())
+		bgi.Metadata.IndexCreationTime = Time(time.Unix(d.varint(), 0))
+	}
+
+	nRows := d.uvarint()
+	if d.err == nil && nRows > uint64(len(d.data)) {
+		return nil, fmt.Errorf("Compact index claims %d rows but has only %d bytes left", nRows, len(d.data))
+	}
+	rows := make([]VariantIndex, 0, nRows)
+	for uint64(len(rows)) < nRows && d.err == nil {
+		chromosome := d.string()
+		n := d.uvarint()
+		var position uint32
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			position += uint32(d.uvarint())
+			row := VariantIndex{Chromosome: chromosome, Position: position}
+			row.FileStartPosition = uint(d.uvarint())
+			row.SizeInBytes = uint(d.uvarint())
+			row.RSID = d.string()
+			row.NAlleles = uint16(d.uvarint())
+			row.Allele1 = Allele(d.string())
+			row.Allele2 = Allele(d.string())
+			rows = append(rows, row)
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if uint64(len(rows)) != nRows {
+		return nil, fmt.Errorf("Compact index claims %d rows but has %d", nRows, len(rows))
+	}
+
+	bgi.compact.rows = rows
+
+	return bgi, nil
+}
+
+func sortCompactRows(rows []VariantIndex) {
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Chromosome != rows[j].Chromosome {
+			return rows[i].Chromosome < rows[j].Chromosome
+		}
+		if rows[i].Position != rows[j].Position {
+			return rows[i].Position < rows[j].Position
+		}
+		return rows[i].FileStartPosition < rows[j].FileStartPosition
+	})
+}
+
+func (c *compactIndex) variantsInRegion(r Region) []VariantIndex {
+	// The first row at or after (chromosome, position)
+	search := func(position uint64) int {
+		return sort.Search(len(c.rows), func(i int) bool {
+			row := c.rows[i]
+			if row.Chromosome != r.Chromosome {
+				return row.Chromosome > r.Chromosome
+			}
+			return uint64(row.Position) >= position
+		})
+	}
+
+	// A region that ends before it starts matches nothing, as with BETWEEN
+	lo, hi := search(uint64(r.Start)), search(uint64(r.End)+1)
+	if lo >= hi {
+		return nil
+	}
+
+	return append([]VariantIndex(nil), c.rows[lo:hi]...)
+}
+
+func (c *compactIndex) variantsByRSID(rsids []string) []VariantIndex {
+	wanted := make(map[string]struct{}, len(rsids))
+	for _, rsid := range rsids {
+		wanted[rsid] = struct{}{}
+	}
+
+	var out []VariantIndex
+	for _, row := range c.rows {
+		if _, exists := wanted[row.RSID]; exists {
+			out = append(out, row)
+		}
+	}
+	sortByOffset(out)
+
+	return out
+}
+
+func (c *compactIndex) allVariants() []VariantIndex {
+	out := append([]VariantIndex(nil), c.rows...)
+	sortByOffset(out)
+
+	return out
+}
+
+func sortByOffset(rows []VariantIndex) {
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].FileStartPosition < rows[j].FileStartPosition
+	})
+}
+
+// compactEncoder writes varints and length-prefixed strings, remembering the
+// first error.
+type compactEncoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *compactEncoder) uvarint(v uint64) {
+	if e.err == nil {
+		_, e.err = e.w.Write(e.buf[:binary.PutUvarint(e.buf[:], v)])
+	}
+}
+
+func (e *compactEncoder) varint(v int64) {
+	if e.err == nil {
+		_, e.err = e.w.Write(e.buf[:binary.PutVarint(e.buf[:], v)])
+	}
+}
+
+func (e *compactEncoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+// compactDecoder reads what compactEncoder writes. After the first error,
+// every read returns a zero value.
+type compactDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *compactDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = fmt.Errorf("Compact index is truncated or corrupt")
+		return 0
+	}
+	d.data = d.data[n:]
+
+	return v
+}
+
+func (d *compactDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = fmt.Errorf("Compact index is truncated or corrupt")
+		return 0
+	}
+	d.data = d.data[n:]
+
+	return v
+}
+
+func (d *compactDecoder) string() string {
+	n := d.uvarint()
+	if d.err != nil {
+		return ""
+	}
+	if n > uint64(len(d.data)) {
+		d.err = fmt.Errorf("Compact index is truncated or corrupt")
+		return ""
+	}
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+
+	return s
+}
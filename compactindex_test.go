@@ -0,0 +1,197 @@
+package bgen
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// exampleCompactIndex writes a compact index of the example file into a
+// temporary directory.
+func exampleCompactIndex(t *testing.T) *BGIIndex {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "example.bgen"+CompactIndexExtension)
+	if err := CreateCompactIndex(exampleBGENPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { idx.Close() })
+
+	return idx
+}
+
+func TestCompactIndex(t *testing.T) {
+	compact := exampleCompactIndex(t)
+	if compact.DB != nil {
+		t.Fatal("Expected OpenIndex to open a compact index without SQLite")
+	}
+	if compact.Metadata.FileSize == 0 || len(compact.Metadata.FirstThousandBytes) != 1000 {
+		t.Errorf("Unexpected metadata %+v", compact.Metadata)
+	}
+
+	rows, err := compact.AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 199 || rows[0].RSID != "RSID_2" || rows[0].Position != 2000 {
+		t.Fatalf("Got %d rows starting with %+v", len(rows), rows[0])
+	}
+	for i := 1; i < len(rows); i++ {
+		if rows[i].FileStartPosition != rows[i-1].FileStartPosition+rows[i-1].SizeInBytes {
+			t.Fatalf("Row %d starts at %d, not where row %d ends", i, rows[i].FileStartPosition, i-1)
+		}
+	}
+
+	inRegion, err := compact.VariantsInRegion(Region{Chromosome: "01", Start: 2000, End: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inRegion) != 7 {
+		t.Errorf("Got %d variants in the region, expected 7", len(inRegion))
+	}
+	if backwards, _ := compact.VariantsInRegion(Region{Chromosome: "01", Start: 5000, End: 2000}); len(backwards) != 0 {
+		t.Errorf("Got %d variants in a region that ends before it starts", len(backwards))
+	}
+
+	byRSID, err := compact.VariantsByRSID("RSID_5", "RSID_3", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byRSID) != 2 || byRSID[0].RSID != "RSID_3" {
+		t.Errorf("Got %+v for 2 rsIDs, expected them in file order", byRSID)
+	}
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	report, err := compact.Verify(b, VerifyOptions{Fraction: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.NVariantsRead != 199 {
+		t.Errorf("Verifying the compact index read %d variants and found %v", report.NVariantsRead, report.Problems)
+	}
+}
+
+func TestCompactIndexConversion(t *testing.T) {
+	requireSQLite(t)
+
+	bgi := exampleBGI(t)
+	compact := exampleCompactIndex(t)
+	compareIndexes(t, bgi, compact)
+
+	// Converting to .bgi and back preserves every row and the metadata
+	dir := t.TempDir()
+	convertedPath := filepath.Join(dir, "converted.bgi")
+	if err := compact.WriteBGI(convertedPath); err != nil {
+		t.Fatal(err)
+	}
+	converted, err := OpenIndex(convertedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer converted.Close()
+	if converted.DB == nil {
+		t.Fatal("Expected OpenIndex to open a .bgi file with SQLite")
+	}
+	compareIndexes(t, compact, converted)
+
+	if !reflect.DeepEqual(compact.Metadata.FirstThousandBytes, converted.Metadata.FirstThousandBytes) ||
+		!time.Time(compact.Metadata.LastWriteTime).Equal(time.Time(converted.Metadata.LastWriteTime)) {
+		t.Errorf("Metadata %+v did not survive conversion to %+v", compact.Metadata, converted.Metadata)
+	}
+
+	compactPath := filepath.Join(dir, "roundtrip"+CompactIndexExtension)
+	if err := converted.WriteCompactIndex(compactPath); err != nil {
+		t.Fatal(err)
+	}
+	roundTrip, err := OpenIndex(compactPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer roundTrip.Close()
+	compareIndexes(t, compact, roundTrip)
+
+	bgiInfo, err := os.Stat(convertedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compactInfo, _ := os.Stat(compactPath); compactInfo.Size() >= bgiInfo.Size() {
+		t.Errorf("The compact index has %d bytes, more than the %d of the .bgi", compactInfo.Size(), bgiInfo.Size())
+	}
+}
+
+// compareIndexes checks that two indexes answer queries identically.
+func compareIndexes(t *testing.T, want, got *BGIIndex) {
+	t.Helper()
+
+	wantRows, err := want.AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotRows, err := got.AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(wantRows, gotRows) {
+		t.Fatalf("AllVariants returned %d rows, expected %d identical rows", len(gotRows), len(wantRows))
+	}
+
+	for _, r := range []Region{
+		{Chromosome: "01", Start: 2000, End: 5000},
+		{Chromosome: "01", Start: 0, End: 1999},
+		{Chromosome: "01", Start: 0, End: 1 << 31},
+		{Chromosome: "02", Start: 0, End: 1 << 31},
+		{Chromosome: "01", Start: 5000, End: 2000},
+	} {
+		wantRows, err := want.VariantsInRegion(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotRows, err := got.VariantsInRegion(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(wantRows, gotRows) {
+			t.Errorf("VariantsInRegion(%s) returned %d rows, expected %d identical rows", r, len(gotRows), len(wantRows))
+		}
+	}
+
+	wantRows, err = want.VariantsByRSID("RSID_5", "RSID_3", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotRows, err = got.VariantsByRSID("RSID_5", "RSID_3", "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotRows) != 2 || !reflect.DeepEqual(wantRows, gotRows) {
+		t.Errorf("VariantsByRSID returned %+v, expected %+v", gotRows, wantRows)
+	}
+}
+
+func TestCompactIndexCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "example.bgix")
+	if err := CreateCompactIndex(exampleBGENPath, path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{len(compactIndexMagic) - 1, len(compactIndexMagic) + 1, len(data) / 2, len(data) - 1} {
+		if _, err := decodeCompactIndex(data[:size]); err == nil {
+			t.Errorf("Expected an error for a compact index truncated to %d of %d bytes", size, len(data))
+		}
+	}
+}
@@ -1,5 +1,12 @@
 package bgen
 
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
 // Compression indicates how (and whether) the SNP block probability is compressed
 type Compression uint32
 
@@ -22,3 +29,27 @@ func (c Compression) String() string {
 		return "Illegal selection"
 	}
 }
+
+// decompress inflates a compressed genotype probability block.
+func decompress(c Compression, input []byte) ([]byte, error) {
+	switch c {
+	case CompressionDisabled:
+		return input, nil
+	case CompressionZLIB:
+		reader, err := zlib.NewReader(bytes.NewReader(input))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		bb := &bytes.Buffer{}
+		if _, err := io.Copy(bb, reader); err != nil {
+			return nil, err
+		}
+		return bb.Bytes(), nil
+	case CompressionZStandard:
+		return DecompressZStandard(nil, input)
+	}
+
+	return nil, fmt.Errorf("Compression choice %s is not supported", c)
+}
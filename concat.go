@@ -0,0 +1,244 @@
+package bgen
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/carbocation/pfx"
+)
+
+// Concatenate writes the variants of each input, in order, to w as a single
+// BGEN file. All inputs must have identical samples, layout and compression.
+// Variant blocks are copied byte-for-byte without being decoded, and the
+// header (including the variant count) is written fresh. The free data area
+// of the first input's header is carried over. If w cannot seek, such as a
+// pipe, the output is streamed with the sum of the inputs' declared variant
+// counts in its header.
+func Concatenate(w io.Writer, inputs ...*BGEN) error {
+	if len(inputs) == 0 {
+		return pfx.Err(fmt.Errorf("No inputs were provided"))
+	}
+
+	first := inputs[0]
+	var sampleIDs []string
+	if first.FlagHasSampleIDs {
+		samples, err := ReadSamples(first)
+		if err != nil {
+			return pfx.Err(err)
+		}
+		sampleIDs = sampleIDStrings(samples)
+	}
+
+	for _, b := range inputs[1:] {
+		if err := checkConcatenationCompatible(first, b, sampleIDs); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	freeData, err := readFreeData(first)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	var nVariants uint32
+	for _, b := range inputs {
+		nVariants += b.NVariants
+	}
+
+	out, err := newWriterFor(w, first.NSamples, nVariants, WriterOptions{
+		Layout:      first.FlagLayout,
+		Compression: first.FlagCompression,
+		SampleIDs:   sampleIDs,
+		FreeData:    freeData,
+	})
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	for _, b := range inputs {
+		vr := b.NewVariantReader()
+		offset := int64(vr.currentOffset)
+		for {
+			block, next, err := vr.rawVariantAtOffset(offset)
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return pfx.Err(fmt.Errorf("%s: variant at offset %d: %w", b.FilePath, offset, err))
+			}
+			if err := out.writeRawVariant(block); err != nil {
+				return pfx.Err(err)
+			}
+			offset = next
+		}
+	}
+
+	return pfx.Err(out.Close())
+}
+
+func checkConcatenationCompatible(first, b *BGEN, sampleIDs []string) error {
+	if b.FlagLayout != first.FlagLayout {
+		return fmt.Errorf("%s has layout %s, but %s has layout %s", b.FilePath, b.FlagLayout, first.FilePath, first.FlagLayout)
+	}
+	if b.FlagCompression != first.FlagCompression {
+		return fmt.Errorf("%s has compression %s, but %s has compression %s", b.FilePath, b.FlagCompression, first.FilePath, first.FlagCompression)
+	}
+	if b.NSamples != first.NSamples {
+		return fmt.Errorf("%s has %d samples, but %s has %d", b.FilePath, b.NSamples, first.FilePath, first.NSamples)
+	}
+	if b.FlagHasSampleIDs != first.FlagHasSampleIDs {
+		return fmt.Errorf("Only one of %s and %s has sample IDs", b.FilePath, first.FilePath)
+	}
+	if !b.FlagHasSampleIDs {
+		return nil
+	}
+
+	samples, err := ReadSamples(b)
+	if err != nil {
+		return err
+	}
+	for i, s := range samples {
+		if s.SampleID != sampleIDs[i] {
+			return fmt.Errorf("Sample %d is %s in %s, but %s in %s", i, s.SampleID, b.FilePath, sampleIDs[i], first.FilePath)
+		}
+	}
+
+	return nil
+}
+
+// MergeSamples joins inputs that contain the same variants, in the same
+// order, for disjoint sets of samples. The samples of the output are those of
+// each input in turn. Because every variant must be decoded and re-encoded,
+// opts controls the layout, compression and bit depth of the output;
+// opts.SampleIDs is ignored and derived from the inputs instead, so either
+// every input or none of them must have sample IDs. Phased variants cannot
+// be merged, since the writer does not yet support them. If w cannot seek,
+// the output is streamed as in Concatenate.
+func MergeSamples(w io.Writer, opts WriterOptions, inputs ...*BGEN) error {
+	if len(inputs) == 0 {
+		return pfx.Err(fmt.Errorf("No inputs were provided"))
+	}
+
+	var nSamples uint32
+	for _, b := range inputs {
+		nSamples += b.NSamples
+		if b.FlagHasSampleIDs != inputs[0].FlagHasSampleIDs {
+			return pfx.Err(fmt.Errorf("Only one of %s and %s has sample IDs", b.FilePath, inputs[0].FilePath))
+		}
+	}
+
+	opts.SampleIDs = nil
+	if inputs[0].FlagHasSampleIDs {
+		seen := make(map[string]string)
+		for _, b := range inputs {
+			samples, err := ReadSamples(b)
+			if err != nil {
+				return pfx.Err(err)
+			}
+			for _, s := range samples {
+				if other, exists := seen[s.SampleID]; exists {
+					return pfx.Err(fmt.Errorf("Sample %s is present in both %s and %s", s.SampleID, other, b.FilePath))
+				}
+				seen[s.SampleID] = b.FilePath
+				opts.SampleIDs = append(opts.SampleIDs, s.SampleID)
+			}
+		}
+	}
+
+	out, err := newWriterFor(w, nSamples, inputs[0].NVariants, opts)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	readers := make([]*VariantReader, len(inputs))
+	for i, b := range inputs {
+		readers[i] = b.NewVariantReader()
+	}
+
+	merged := &Variant{}
+	for {
+		var first *Variant
+		merged.SampleProbabilities = merged.SampleProbabilities[:0]
+		for i, vr := range readers {
+			v := vr.Read()
+			if err := vr.Error(); err != nil {
+				return pfx.Err(fmt.Errorf("%s: %w", inputs[i].FilePath, err))
+			}
+			if i > 0 && (v == nil) != (first == nil) {
+				return pfx.Err(fmt.Errorf("%s has a different number of variants than %s", inputs[i].FilePath, inputs[0].FilePath))
+			}
+			if v == nil {
+				continue
+			}
+			if i == 0 {
+				first = v
+			} else if err := sameVariant(first, v); err != nil {
+				return pfx.Err(fmt.Errorf("Variant %d of %s does not match %s: %w", vr.VariantsSeen, inputs[i].FilePath, inputs[0].FilePath, err))
+			}
+			merged.SampleProbabilities = append(merged.SampleProbabilities, v.SampleProbabilities...)
+		}
+		if first == nil {
+			break
+		}
+		if first.Phased {
+			return pfx.Err(fmt.Errorf("Variant %s is phased; merging phased data is not supported", first.ID))
+		}
+
+		merged.ID = first.ID
+		merged.RSID = first.RSID
+		merged.Chromosome = first.Chromosome
+		merged.Position = first.Position
+		merged.NAlleles = first.NAlleles
+		merged.Alleles = first.Alleles
+		merged.Phased = first.Phased
+		if err := out.WriteVariant(merged); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	return pfx.Err(out.Close())
+}
+
+// sameVariant reports an error if a and b do not describe the same variant.
+func sameVariant(a, b *Variant) error {
+	if a.Chromosome != b.Chromosome || a.Position != b.Position {
+		return fmt.Errorf("%s:%d vs %s:%d", a.Chromosome, a.Position, b.Chromosome, b.Position)
+	}
+	if a.RSID != b.RSID {
+		return fmt.Errorf("RSID %s vs %s", a.RSID, b.RSID)
+	}
+	if len(a.Alleles) != len(b.Alleles) {
+		return fmt.Errorf("%d alleles vs %d", len(a.Alleles), len(b.Alleles))
+	}
+	for i := range a.Alleles {
+		if a.Alleles[i] != b.Alleles[i] {
+			return fmt.Errorf("allele %d is %s vs %s", i+1, a.Alleles[i], b.Alleles[i])
+		}
+	}
+	if a.Phased != b.Phased {
+		return fmt.Errorf("phased %v vs %v", a.Phased, b.Phased)
+	}
+
+	return nil
+}
+
+// readFreeData returns the free data area of the header block.
+func readFreeData(b *BGEN) ([]byte, error) {
+	headerLength := int64(b.SamplesStart) - 4
+	buf := make([]byte, headerLength-offsetFreeStorage)
+	if len(buf) == 0 {
+		return nil, nil
+	}
+	if err := b.parseAtOffsetWithBuffer(offsetFreeStorage, buf); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return buf, nil
+}
+
+func sampleIDStrings(samples []Sample) []string {
+	out := make([]string, len(samples))
+	for i, s := range samples {
+		out[i] = s.SampleID
+	}
+	return out
+}
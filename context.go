@@ -0,0 +1,57 @@
+package bgen
+
+import (
+	"context"
+	"io"
+
+	"github.com/carbocation/genomisc"
+)
+
+// ReaderAtContext is implemented by backends whose reads can be cancelled.
+// Backends registered with RegisterScheme should implement it if their
+// reads can block; others are checked for cancellation before each read.
+type ReaderAtContext interface {
+	ReadAtContext(ctx context.Context, p []byte, off int64) (int, error)
+}
+
+// readAtContext reads from r, observing ctx as closely as r allows.
+func readAtContext(ctx context.Context, r io.ReaderAt, p []byte, off int64) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	switch r := r.(type) {
+	case ReaderAtContext:
+		return r.ReadAtContext(ctx, p, off)
+	case *genomisc.GSReaderAtCloser:
+		withContext := &genomisc.GSReaderAtCloser{ObjectHandle: r.ObjectHandle, Context: ctx}
+		return withContext.ReadAt(p, off)
+	}
+
+	return r.ReadAt(p, off)
+}
+
+// context returns the context that governs reads from b.
+func (b *BGEN) context() context.Context {
+	if b.ctx == nil {
+		return context.Background()
+	}
+	return b.ctx
+}
+
+// ReadContext is like Read, but stops with ctx's error, which is also
+// recorded for Error, if ctx is done before or during the read.
+func (vr *VariantReader) ReadContext(ctx context.Context) *Variant {
+	vr.ctx = ctx
+	defer func() { vr.ctx = nil }()
+
+	return vr.Read()
+}
+
+// context returns the context that governs the VariantReader's current read.
+func (vr *VariantReader) context() context.Context {
+	if vr.ctx != nil {
+		return vr.ctx
+	}
+	return vr.b.context()
+}
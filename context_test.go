@@ -0,0 +1,106 @@
+package bgen
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadContext(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	vr := b.NewVariantReader()
+	for i := 0; i < 5; i++ {
+		if v := vr.ReadContext(ctx); v == nil {
+			t.Fatal(vr.Error())
+		}
+	}
+
+	cancel()
+	if v := vr.ReadContext(ctx); v != nil {
+		t.Fatal("Expected no variant after cancellation")
+	}
+	if !errors.Is(vr.Error(), context.Canceled) {
+		t.Errorf("Got error %v, expected context.Canceled", vr.Error())
+	}
+
+	// Plain Read is unaffected by a previous ReadContext's context
+	if v := b.NewVariantReader().Read(); v == nil {
+		t.Error("Expected Read to ignore the cancelled context")
+	}
+}
+
+func TestOpenContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b, err := OpenContext(ctx, exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, err := ReadSamples(b); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+
+	if _, err := ReadSamples(b); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadSamples: got error %v, expected context.Canceled", err)
+	}
+
+	vr := b.NewVariantReader()
+	if v := vr.Read(); v != nil || !errors.Is(vr.Error(), context.Canceled) {
+		t.Errorf("Read: got error %v, expected context.Canceled", vr.Error())
+	}
+}
+
+func TestReadContextHTTPIsPrompt(t *testing.T) {
+	var stall int32
+	fileServer := http.FileServer(http.Dir(filepath.Dir(exampleBGENPath)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&stall) == 1 {
+			// Hang until the client gives up
+			<-r.Context().Done()
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	opts := OpenOptions{Cache: CacheOptions{BlockSize: 4 << 10, MaxBlocks: 4}}
+	b, err := OpenWithOptions(context.Background(), srv.URL+"/"+filepath.Base(exampleBGENPath), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	vr := b.NewVariantReader()
+	if v := vr.Read(); v == nil {
+		t.Fatal(vr.Error())
+	}
+
+	atomic.StoreInt32(&stall, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	for v := vr.ReadContext(ctx); v != nil; v = vr.ReadContext(ctx) {
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Took %s to notice the deadline", elapsed)
+	}
+	if !errors.Is(vr.Error(), context.DeadlineExceeded) {
+		t.Errorf("Got error %v, expected context.DeadlineExceeded", vr.Error())
+	}
+}
@@ -0,0 +1,61 @@
+package bgen
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/carbocation/pfx"
+)
+
+// Dosages computes the expected count of the second allele for each sample of
+// an unphased, biallelic variant. Missing samples (and Layout1 samples whose
+// probabilities are all zero, which is how Layout1 encodes missingness) are
+// represented as NaN. If dst has enough capacity, it is reused.
+func (v *Variant) Dosages(dst []float64) ([]float64, error) {
+	if err := v.decoded(); err != nil {
+		return nil, pfx.Err(err)
+	}
+	if v.NAlleles != 2 {
+		return nil, pfx.Err(fmt.Errorf("Dosages can only be computed for biallelic variants, but %s has %d alleles", v.ID, v.NAlleles))
+	}
+	if v.Phased {
+		return nil, pfx.Err(fmt.Errorf("Dosages can only be computed for unphased variants, but %s is phased", v.ID))
+	}
+
+	if cap(dst) < len(v.SampleProbabilities) {
+		dst = make([]float64, len(v.SampleProbabilities))
+	}
+	dst = dst[:len(v.SampleProbabilities)]
+
+	for i, sp := range v.SampleProbabilities {
+		dst[i] = sp.dosageBiallelic()
+	}
+
+	return dst, nil
+}
+
+// dosageBiallelic assumes an unphased, biallelic sample. For a biallelic
+// variant, the genotype with k copies of the second allele is stored at
+// position k, except for the final genotype, which the reader always places at
+// the end of the (possibly longer) Probabilities slice.
+func (sp SampleProbability) dosageBiallelic() float64 {
+	if sp.Missing || len(sp.Probabilities) == 0 {
+		return math.NaN()
+	}
+
+	ploidy := int(sp.Ploidy)
+	var dosage, sum float64
+	for k := 0; k < ploidy; k++ {
+		dosage += float64(k) * sp.Probabilities[k]
+		sum += sp.Probabilities[k]
+	}
+	last := sp.Probabilities[len(sp.Probabilities)-1]
+	dosage += float64(ploidy) * last
+	sum += last
+
+	if sum == 0 {
+		return math.NaN()
+	}
+
+	return dosage
+}
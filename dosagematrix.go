@@ -0,0 +1,302 @@
+package bgen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/carbocation/pfx"
+)
+
+// DosageMatrix is a dense samples x variants matrix of expected counts of
+// the second allele, stored column-major so that each variant's dosages are
+// contiguous. Missing values are NaN.
+type DosageMatrix[T float32 | float64] struct {
+	SampleIDs []string
+	Variants  []VariantIndex
+
+	// Values holds the dosage of sample i at variant j at
+	// Values[j*len(SampleIDs)+i].
+	Values []T
+}
+
+// At returns the dosage of sample i at variant j.
+func (m *DosageMatrix[T]) At(i, j int) T {
+	return m.Values[j*len(m.SampleIDs)+i]
+}
+
+// Column returns the dosages of every sample at variant j. It aliases
+// Values.
+func (m *DosageMatrix[T]) Column(j int) []T {
+	n := len(m.SampleIDs)
+	return m.Values[j*n : (j+1)*n : (j+1)*n]
+}
+
+// ExtractDosageMatrix returns the dosages of the given samples, in the order
+// given, at every variant that bgi places in region. If samples is nil,
+// every sample is included in file order. Variants are decoded in parallel
+// straight from their genotype blocks, without building Variant structs.
+// Every variant in the region must be unphased and biallelic.
+func ExtractDosageMatrix(b *BGEN, bgi *BGIIndex, region Region, samples []string) (*DosageMatrix[float64], error) {
+	rows, err := bgi.VariantsInRegion(region)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return extractDosageMatrix[float64](b, rows, samples)
+}
+
+// ExtractDosageMatrix32 is like ExtractDosageMatrix, but stores the dosages
+// as float32, halving the memory used.
+func ExtractDosageMatrix32(b *BGEN, bgi *BGIIndex, region Region, samples []string) (*DosageMatrix[float32], error) {
+	rows, err := bgi.VariantsInRegion(region)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return extractDosageMatrix[float32](b, rows, samples)
+}
+
+func extractDosageMatrix[T float32 | float64](b *BGEN, rows []VariantIndex, samples []string) (*DosageMatrix[T], error) {
+	m := &DosageMatrix[T]{Variants: rows}
+
+	var columnIndex []int
+	if samples == nil {
+		if b.FlagHasSampleIDs {
+			all, err := ReadSamples(b)
+			if err != nil {
+				return nil, pfx.Err(err)
+			}
+			m.SampleIDs = sampleIDStrings(all)
+		} else {
+			m.SampleIDs = make([]string, b.NSamples)
+		}
+	} else {
+		all, err := ReadSamples(b)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		if columnIndex, err = sampleIndicesInOrder(all, samples); err != nil {
+			return nil, pfx.Err(err)
+		}
+		m.SampleIDs = samples
+	}
+
+	nSamples := len(m.SampleIDs)
+	m.Values = make([]T, nSamples*len(rows))
+
+	jobs := make(chan int)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			vr := b.NewVariantReader()
+			scratch := make([]float64, b.NSamples)
+			for j := range jobs {
+				if err := vr.dosagesAtIndexRow(rows[j], scratch); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					continue
+				}
+
+				column := m.Column(j)
+				if columnIndex == nil {
+					for i, d := range scratch {
+						column[i] = T(d)
+					}
+				} else {
+					for i, idx := range columnIndex {
+						column[i] = T(scratch[idx])
+					}
+				}
+			}
+		}()
+	}
+
+	for j := range rows {
+		if len(errs) > 0 {
+			break
+		}
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, pfx.Err(err)
+	default:
+	}
+
+	return m, nil
+}
+
+// sampleIndicesInOrder maps each wanted ID to its position in samples.
+func sampleIndicesInOrder(samples []Sample, ids []string) ([]int, error) {
+	position := make(map[string]int, len(samples))
+	for i, s := range samples {
+		position[s.SampleID] = i
+	}
+
+	out := make([]int, len(ids))
+	for i, id := range ids {
+		idx, exists := position[id]
+		if !exists {
+			return nil, fmt.Errorf("Sample %s is not present in the file", id)
+		}
+		out[i] = idx
+	}
+
+	return out, nil
+}
+
+// dosagesAtIndexRow decodes the dosage of every sample at the variant that
+// row describes into dst, which must have one entry per sample in the file.
+func (vr *VariantReader) dosagesAtIndexRow(row VariantIndex, dst []float64) error {
+	if err := vr.checkIndexRow(row); err != nil {
+		return err
+	}
+
+	block, err := vr.bytesAtOffset(int(row.SizeInBytes), int64(row.FileStartPosition))
+	if err != nil {
+		return fmt.Errorf("Index row for %s at offset %d: %w", row.RSID, row.FileStartPosition, err)
+	}
+
+	v, cursor, err := variantIdentifiersFromBlock(block, vr.b.FlagLayout)
+	if err != nil {
+		return fmt.Errorf("Index row for %s at offset %d: %w", row.RSID, row.FileStartPosition, err)
+	}
+	if v.Position != row.Position || v.RSID != row.RSID {
+		return fmt.Errorf("Index row for %s at %d points to %s at %d", row.RSID, row.Position, v.RSID, v.Position)
+	}
+	if v.NAlleles != 2 {
+		return fmt.Errorf("Dosages can only be computed for biallelic variants, but %s has %d alleles", v.ID, v.NAlleles)
+	}
+
+	if err := dosagesFromGenotypeBlock(vr.b, block[cursor:], dst); err != nil {
+		return fmt.Errorf("Variant %s: %w", v.ID, err)
+	}
+
+	return nil
+}
+
+// dosagesFromGenotypeBlock computes dosages directly from the genotype
+// section of a biallelic variant block. It follows the same conventions as
+// Variant.Dosages.
+func dosagesFromGenotypeBlock(b *BGEN, section []byte, dst []float64) error {
+	var compressed []byte
+	expectedSize := -1
+
+	switch {
+	case b.FlagLayout == Layout1 && b.FlagCompression == CompressionDisabled:
+		compressed = section
+	case b.FlagLayout == Layout1 || b.FlagCompression == CompressionDisabled:
+		if len(section) < 4 {
+			return fmt.Errorf("Genotype block of %d bytes is too short", len(section))
+		}
+		compressed = section[4:]
+	default:
+		if len(section) < 8 {
+			return fmt.Errorf("Genotype block of %d bytes is too short", len(section))
+		}
+		expectedSize = int(binary.LittleEndian.Uint32(section[4:8]))
+		compressed = section[8:]
+	}
+
+	data, err := decompress(b.FlagCompression, compressed)
+	if err != nil {
+		return err
+	}
+	if expectedSize >= 0 && len(data) != expectedSize {
+		return fmt.Errorf("Expected to decompress %d bytes, got %d", expectedSize, len(data))
+	}
+
+	if b.FlagLayout == Layout1 {
+		if len(data) != 6*len(dst) {
+			return fmt.Errorf("Expected %d bytes of Layout1 probabilities, got %d", 6*len(dst), len(data))
+		}
+		for i := range dst {
+			p1 := float64(binary.LittleEndian.Uint16(data[6*i+2:]))
+			p2 := float64(binary.LittleEndian.Uint16(data[6*i+4:]))
+			if p0 := binary.LittleEndian.Uint16(data[6*i:]); p0 == 0 && p1 == 0 && p2 == 0 {
+				dst[i] = math.NaN()
+				continue
+			}
+			dst[i] = (p1 + 2*p2) / 32768
+		}
+		return nil
+	}
+
+	return dosagesFromLayout2Probabilities(data, dst)
+}
+
+func dosagesFromLayout2Probabilities(data []byte, dst []float64) error {
+	if len(data) < 8 {
+		return fmt.Errorf("Probability block of %d bytes is too short", len(data))
+	}
+
+	nSamples := int(binary.LittleEndian.Uint32(data[0:4]))
+	if nSamples != len(dst) {
+		return fmt.Errorf("Probability block has %d samples, expected %d", nSamples, len(dst))
+	}
+	if nAlleles := binary.LittleEndian.Uint16(data[4:6]); nAlleles != 2 {
+		return fmt.Errorf("Probability block has %d alleles, expected 2", nAlleles)
+	}
+
+	cursor := 8
+	if len(data) < cursor+nSamples+2 {
+		return fmt.Errorf("Probability block of %d bytes is too short for %d samples", len(data), nSamples)
+	}
+	ploidies := data[cursor : cursor+nSamples]
+	cursor += nSamples
+
+	if data[cursor] != 0 {
+		return fmt.Errorf("Dosages can only be computed for unphased variants")
+	}
+	nBits := int(data[cursor+1])
+	if nBits < 1 || nBits > 32 {
+		return fmt.Errorf("Number of bits per probability was %d (must be 1-32 inclusive)", nBits)
+	}
+	cursor += 2
+
+	// Each unphased, biallelic sample of ploidy p stores p values
+	var nValues int
+	for _, pm := range ploidies {
+		nValues += int(pm & 63)
+	}
+	if len(data)-cursor < (nValues*nBits+7)/8 {
+		return fmt.Errorf("Probability block of %d bytes is too short for %d values of %d bits", len(data), nValues, nBits)
+	}
+
+	rdr := newBitReader(data[cursor:], nBits)
+	denom := float64(uint64(1)<<uint64(nBits) - 1)
+
+	for i, pm := range ploidies {
+		ploidy := int(pm & 63)
+
+		var dosage float64
+		var pSum uint64
+		for k := 0; k < ploidy; k++ {
+			probBits := rdr.Next()
+			pSum += uint64(probBits)
+			dosage += float64(k) * float64(probBits)
+		}
+
+		if pm&128 != 0 {
+			dst[i] = math.NaN()
+			continue
+		}
+
+		dst[i] = (dosage + float64(ploidy)*(denom-float64(pSum))) / denom
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package bgen
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExtractDosageMatrix(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	bgi := exampleBGI(t)
+
+	region := Region{Chromosome: "01", Start: 2000, End: 5000}
+	samples := []string{"sample_010", "sample_002", "sample_499"}
+
+	m, err := ExtractDosageMatrix(b, bgi, region, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Variants) != 7 || len(m.Values) != 7*len(samples) {
+		t.Fatalf("Got %d variants and %d values, expected 7 and %d", len(m.Variants), len(m.Values), 7*len(samples))
+	}
+
+	all, err := ExtractDosageMatrix32(b, bgi, region, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.SampleIDs) != 500 || all.SampleIDs[9] != "sample_010" {
+		t.Fatalf("Got %d sample IDs, expected 500 in file order", len(all.SampleIDs))
+	}
+
+	fileIndex := map[string]int{"sample_010": 9, "sample_002": 1, "sample_499": 498}
+	vr := b.NewVariantReader()
+	for j, row := range m.Variants {
+		want, err := vr.ReadIndexed(row).Dosages(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, id := range samples {
+			got, expected := m.At(i, j), want[fileIndex[id]]
+			if math.IsNaN(expected) {
+				if !math.IsNaN(got) {
+					t.Errorf("Variant %s sample %s: got %v, expected NaN", row.RSID, id, got)
+				}
+			} else if math.Abs(got-expected) > 1e-12 {
+				t.Errorf("Variant %s sample %s: got %v, expected %v", row.RSID, id, got, expected)
+			}
+		}
+
+		for i, d := range all.Column(j) {
+			if math.IsNaN(want[i]) != math.IsNaN(float64(d)) || math.Abs(float64(d)-want[i]) > 1e-6 {
+				t.Fatalf("Variant %s sample %d: got float32 %v, expected %v", row.RSID, i, d, want[i])
+			}
+		}
+	}
+
+	if _, err := ExtractDosageMatrix(b, bgi, region, []string{"nobody"}); err == nil {
+		t.Error("Expected an error for an unknown sample")
+	}
+}
@@ -0,0 +1,314 @@
+package bgen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/carbocation/pfx"
+)
+
+// GENOptions controls how Oxford GEN files are read and written.
+type GENOptions struct {
+	// Chromosome is assigned to variants read from lines without a leading
+	// chromosome column. Whether a line has the column is detected from its
+	// number of fields.
+	Chromosome string
+
+	// ChromosomeColumn makes GENWriter start each line with the variant's
+	// chromosome, as in the six-column form of the format.
+	ChromosomeColumn bool
+
+	// Gzip makes GENWriter compress its output. Gzipped input is detected
+	// automatically.
+	Gzip bool
+
+	// Precision is the number of significant digits GENWriter uses for each
+	// probability. Defaults to 6; -1 writes the shortest exact form.
+	Precision int
+}
+
+// GENReader reads variants from an Oxford GEN file, in which each line holds
+// a SNP ID, rsID, position, two alleles and then three genotype
+// probabilities per sample, optionally preceded by the chromosome. Samples
+// whose three probabilities are all zero are marked Missing.
+type GENReader struct {
+	// NSamples is determined from the first line of the file.
+	NSamples     uint32
+	VariantsSeen int
+
+	opts    GENOptions
+	r       *bufio.Reader
+	closers []io.Closer
+	line    int
+	started bool
+	next    *Variant
+	err     error
+}
+
+// OpenGEN opens a GEN file, which may be gzipped.
+func OpenGEN(path string, opts GENOptions) (*GENReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	gr, err := NewGENReader(f, opts)
+	if err != nil {
+		f.Close()
+		return nil, pfx.Err(err)
+	}
+	gr.closers = append(gr.closers, f)
+
+	return gr, nil
+}
+
+// NewGENReader reads GEN data from r, which may be gzipped. The first line is
+// read immediately to determine NSamples.
+func NewGENReader(r io.Reader, opts GENOptions) (*GENReader, error) {
+	gr := &GENReader{opts: opts, r: bufio.NewReaderSize(r, 1<<20)}
+
+	if magic, _ := gr.r.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(gr.r)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		gr.r = bufio.NewReaderSize(zr, 1<<20)
+		gr.closers = append(gr.closers, zr)
+	}
+
+	v, err := gr.parseLine()
+	if err != nil && err != io.EOF {
+		gr.Close()
+		return nil, pfx.Err(err)
+	}
+	gr.next = v
+
+	return gr, nil
+}
+
+// Read returns the next variant, or nil at the end of the file or after an
+// error, which is then available from Error.
+func (gr *GENReader) Read() *Variant {
+	if gr.err != nil {
+		return nil
+	}
+
+	if v := gr.next; v != nil {
+		gr.next = nil
+		gr.VariantsSeen++
+		return v
+	}
+
+	v, err := gr.parseLine()
+	if err != nil {
+		if err != io.EOF {
+			gr.err = pfx.Err(err)
+		}
+		return nil
+	}
+	gr.VariantsSeen++
+
+	return v
+}
+
+// Error returns the error that stopped Read, if any. Reaching the end of the
+// file is not an error.
+func (gr *GENReader) Error() error {
+	return gr.err
+}
+
+// Close closes the gzip stream and the file opened by OpenGEN, if any.
+func (gr *GENReader) Close() error {
+	var err error
+	for i := len(gr.closers) - 1; i >= 0; i-- {
+		if cerr := gr.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	gr.closers = nil
+
+	return pfx.Err(err)
+}
+
+// parseLine parses the next non-blank line, returning io.EOF when none
+// remain.
+func (gr *GENReader) parseLine() (*Variant, error) {
+	var text string
+	for text == "" {
+		line, err := gr.r.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return nil, err
+		}
+		gr.line++
+		text = strings.TrimSpace(line)
+	}
+
+	fields := strings.Fields(text)
+
+	var chromosome string
+	switch {
+	case len(fields) >= 5 && (len(fields)-5)%3 == 0:
+		chromosome = gr.opts.Chromosome
+	case len(fields) >= 6 && (len(fields)-6)%3 == 0:
+		chromosome, fields = fields[0], fields[1:]
+	default:
+		return nil, fmt.Errorf("Line %d has %d fields, which is not 5 or 6 plus three per sample", gr.line, len(fields))
+	}
+
+	nSamples := (len(fields) - 5) / 3
+	if !gr.started {
+		gr.NSamples = uint32(nSamples)
+		gr.started = true
+	} else if nSamples != int(gr.NSamples) {
+		return nil, fmt.Errorf("Line %d has %d samples, but earlier lines have %d", gr.line, nSamples, gr.NSamples)
+	}
+
+	position, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Line %d: position: %w", gr.line, err)
+	}
+
+	v := &Variant{
+		ID:                  fields[0],
+		RSID:                fields[1],
+		Chromosome:          chromosome,
+		Position:            uint32(position),
+		NAlleles:            2,
+		Alleles:             []Allele{Allele(fields[3]), Allele(fields[4])},
+		MinimumPloidy:       2,
+		MaximumPloidy:       2,
+		SampleProbabilities: make([]SampleProbability, nSamples),
+	}
+
+	probs := make([]float64, 3*nSamples)
+	for i, field := range fields[5:] {
+		if probs[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return nil, fmt.Errorf("Line %d, sample %d: %w", gr.line, i/3, err)
+		}
+	}
+	for i := range v.SampleProbabilities {
+		sp := SampleProbability{Ploidy: 2, Probabilities: probs[3*i : 3*i+3 : 3*i+3]}
+		sp.Missing = isLayout1Missing(sp)
+		v.SampleProbabilities[i] = sp
+	}
+
+	return v, nil
+}
+
+// GENWriter writes variants as Oxford GEN lines.
+type GENWriter struct {
+	opts GENOptions
+	bw   *bufio.Writer
+	zw   *gzip.Writer
+	line []byte
+}
+
+// NewGENWriter returns a GENWriter that writes to w. Close must be called to
+// flush the output; it does not close w.
+func NewGENWriter(w io.Writer, opts GENOptions) *GENWriter {
+	if opts.Precision == 0 {
+		opts.Precision = 6
+	}
+
+	gw := &GENWriter{opts: opts}
+	if opts.Gzip {
+		gw.zw = gzip.NewWriter(w)
+		w = gw.zw
+	}
+	gw.bw = bufio.NewWriterSize(w, 1<<20)
+
+	return gw
+}
+
+// WriteVariant writes v as one line. Only unphased, biallelic variants can be
+// written, and every sample must be diploid or missing. Missing samples are
+// written as three zeroes.
+func (gw *GENWriter) WriteVariant(v *Variant) error {
+	if err := v.decoded(); err != nil {
+		return pfx.Err(err)
+	}
+	if v.NAlleles != 2 || len(v.Alleles) != 2 {
+		return pfx.Err(fmt.Errorf("GEN files can only hold biallelic variants, but %s has %d alleles", v.ID, v.NAlleles))
+	}
+	if v.Phased {
+		return pfx.Err(fmt.Errorf("GEN files can only hold unphased variants, but %s is phased", v.ID))
+	}
+
+	line := gw.line[:0]
+	if gw.opts.ChromosomeColumn {
+		line = append(append(line, genField(v.Chromosome)...), ' ')
+	}
+	line = append(line, genField(v.ID)...)
+	line = append(append(line, ' '), genField(v.RSID)...)
+	line = append(append(line, ' '), strconv.FormatUint(uint64(v.Position), 10)...)
+	line = append(append(line, ' '), v.Alleles[0]...)
+	line = append(append(line, ' '), v.Alleles[1]...)
+
+	for i, sp := range v.SampleProbabilities {
+		if sp.Missing || len(sp.Probabilities) == 0 {
+			line = append(line, " 0 0 0"...)
+			continue
+		}
+		if sp.Ploidy != 2 || len(sp.Probabilities) < 3 {
+			return pfx.Err(fmt.Errorf("Sample %d of variant %s has ploidy %d; GEN files can only hold diploid samples", i, v.ID, sp.Ploidy))
+		}
+
+		// The final genotype is always at the end of the slice
+		for _, p := range []float64{sp.Probabilities[0], sp.Probabilities[1], sp.Probabilities[len(sp.Probabilities)-1]} {
+			line = append(line, ' ')
+			line = strconv.AppendFloat(line, p, 'g', gw.opts.Precision, 64)
+		}
+	}
+	line = append(line, '\n')
+	gw.line = line
+
+	_, err := gw.bw.Write(line)
+	return pfx.Err(err)
+}
+
+// Close flushes buffered output and finishes the gzip stream, if any.
+func (gw *GENWriter) Close() error {
+	if err := gw.bw.Flush(); err != nil {
+		return pfx.Err(err)
+	}
+	if gw.zw != nil {
+		return pfx.Err(gw.zw.Close())
+	}
+
+	return nil
+}
+
+// genField substitutes "." for an empty identifier, which would otherwise
+// shift every following column.
+func genField(s string) string {
+	if s == "" {
+		return "."
+	}
+
+	return s
+}
+
+// WriteGEN writes every remaining variant from src to w as GEN, returning
+// the number written.
+func WriteGEN(w io.Writer, src VariantSource, opts GENOptions) (int, error) {
+	gw := NewGENWriter(w, opts)
+
+	var n int
+	for v := src.Read(); v != nil; v = src.Read() {
+		if err := gw.WriteVariant(v); err != nil {
+			return n, pfx.Err(err)
+		}
+		n++
+	}
+	if err := src.Error(); err != nil {
+		return n, pfx.Err(err)
+	}
+
+	return n, pfx.Err(gw.Close())
+}
@@ -0,0 +1,129 @@
+package bgen
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGENRoundTrip(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var gen bytes.Buffer
+	n, err := WriteGEN(&gen, b.NewVariantReader(), GENOptions{ChromosomeColumn: true, Gzip: true, Precision: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int(b.NVariants) {
+		t.Errorf("Wrote %d variants, expected %d", n, b.NVariants)
+	}
+
+	gr, err := NewGENReader(&gen, GENOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gr.Close()
+	if gr.NSamples != b.NSamples {
+		t.Errorf("Got %d samples, expected %d", gr.NSamples, b.NSamples)
+	}
+
+	// Convert back to BGEN and compare with the original
+	path := filepath.Join(t.TempDir(), "fromgen.bgen")
+	w, err := Create(path, gr.NSamples, WriterOptions{Layout: Layout2, Compression: CompressionZLIB, NProbabilityBits: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for v := gr.Read(); v != nil; v = gr.Read() {
+		if err := w.WriteVariant(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gr.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	compareProbabilities(t, b, got, 1/65535.0)
+}
+
+func TestGENReader(t *testing.T) {
+	input := `
+snp1 rs1 100 A G 1 0 0 0 0 0
+snp2 rs2 200 C T 0.1 0.2 0.7 0.5 0.5 0
+`
+	gr, err := NewGENReader(strings.NewReader(input), GENOptions{Chromosome: "22"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gr.NSamples != 2 {
+		t.Fatalf("Got %d samples, expected 2", gr.NSamples)
+	}
+
+	v := gr.Read()
+	if v == nil {
+		t.Fatal(gr.Error())
+	}
+	if v.Chromosome != "22" || v.RSID != "rs1" || v.Position != 100 || v.Alleles[1] != "G" {
+		t.Errorf("Unexpected variant %+v", v)
+	}
+	if v.SampleProbabilities[0].Missing || !v.SampleProbabilities[1].Missing {
+		t.Errorf("Expected only the second sample to be missing: %+v", v.SampleProbabilities)
+	}
+
+	v = gr.Read()
+	if v == nil {
+		t.Fatal(gr.Error())
+	}
+	dosages, err := v.Dosages(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(dosages[0]-1.6) > 1e-12 || dosages[1] != 0.5 {
+		t.Errorf("Got dosages %v, expected [1.6 0.5]", dosages)
+	}
+
+	if v := gr.Read(); v != nil || gr.Error() != nil {
+		t.Errorf("Expected a clean end of file, got %+v and %v", v, gr.Error())
+	}
+
+	// A line with a different number of samples is an error
+	gr, err = NewGENReader(strings.NewReader("1 snp1 rs1 100 A G 1 0 0\n1 snp2 rs2 200 C T 1 0 0 1 0 0\n"), GENOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := gr.Read(); v == nil || v.Chromosome != "1" {
+		t.Fatalf("Expected the chromosome column to be detected, got %+v (%v)", v, gr.Error())
+	}
+	if v := gr.Read(); v != nil || gr.Error() == nil {
+		t.Errorf("Expected an error for a line with a different number of samples")
+	}
+}
+
+func TestReadSampleFile(t *testing.T) {
+	samples := []Sample{{SampleID: "a"}, {SampleID: "b"}}
+
+	var buf bytes.Buffer
+	if err := WriteSampleFile(&buf, samples); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadSampleFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != samples[0] || got[1] != samples[1] {
+		t.Errorf("Got %v, expected %v", got, samples)
+	}
+}
@@ -0,0 +1,291 @@
+package bgen
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/carbocation/pfx"
+)
+
+// GRMOptions controls which variants contribute to a genetic relationship
+// matrix or to a principal component analysis. Only unphased, biallelic,
+// diploid variants are ever used.
+type GRMOptions struct {
+	// MinMAF is the minimum minor allele frequency, computed among nonmissing
+	// samples, that a variant must have to be used.
+	MinMAF float64
+
+	// MaxMissingRate is the maximum fraction of samples that may be missing
+	// at a variant for it to be used. Zero disables the filter.
+	MaxMissingRate float64
+}
+
+// dosageStream walks a BGEN file and yields the standardized dosages of each
+// variant that passes the GRMOptions filters. Missing samples are set to zero
+// (the mean) in x and are flagged in missing.
+type dosageStream struct {
+	vr   *VariantReader
+	opts GRMOptions
+
+	dosages []float64
+	x       []float64
+	missing []bool
+	nMiss   int
+
+	nSeen int
+}
+
+func newDosageStream(b *BGEN, opts GRMOptions) *dosageStream {
+	return &dosageStream{
+		vr:      b.NewVariantReader(),
+		opts:    opts,
+		x:       make([]float64, b.NSamples),
+		missing: make([]bool, b.NSamples),
+	}
+}
+
+// next advances to the next variant that passes the filters. It returns false
+// once the file is exhausted or an error occurs.
+func (s *dosageStream) next() (bool, error) {
+	for {
+		v := s.vr.Read()
+		if err := s.vr.Error(); err != nil {
+			return false, pfx.Err(err)
+		}
+		if v == nil {
+			return false, nil
+		}
+		s.nSeen++
+
+		if v.NAlleles != 2 || v.Phased || v.MinimumPloidy != 2 || v.MaximumPloidy != 2 {
+			continue
+		}
+		if len(v.SampleProbabilities) != len(s.x) {
+			return false, pfx.Err(fmt.Errorf("Variant %s has %d samples, expected %d", v.ID, len(v.SampleProbabilities), len(s.x)))
+		}
+
+		var err error
+		s.dosages, err = v.Dosages(s.dosages)
+		if err != nil {
+			return false, pfx.Err(err)
+		}
+
+		if s.standardize() {
+			return true, nil
+		}
+	}
+}
+
+// standardize converts the current dosages into x, reporting whether the
+// variant passed the filters.
+func (s *dosageStream) standardize() bool {
+	var sum float64
+	s.nMiss = 0
+	for i, d := range s.dosages {
+		s.missing[i] = math.IsNaN(d)
+		if s.missing[i] {
+			s.nMiss++
+			continue
+		}
+		sum += d
+	}
+
+	nPresent := len(s.dosages) - s.nMiss
+	if nPresent == 0 {
+		return false
+	}
+	if s.opts.MaxMissingRate > 0 && float64(s.nMiss)/float64(len(s.dosages)) > s.opts.MaxMissingRate {
+		return false
+	}
+
+	p := sum / float64(2*nPresent)
+	maf := math.Min(p, 1-p)
+	if maf <= 0 || maf < s.opts.MinMAF {
+		return false
+	}
+
+	mean := 2 * p
+	sd := math.Sqrt(2 * p * (1 - p))
+	for i, d := range s.dosages {
+		if s.missing[i] {
+			s.x[i] = 0
+			continue
+		}
+		s.x[i] = (d - mean) / sd
+	}
+
+	return true
+}
+
+// GRM is a genetic relationship matrix in the form used by GCTA: each entry
+// is the average, over variants where both samples are nonmissing, of the
+// product of their standardized dosages. Only the lower triangle (including
+// the diagonal) is stored.
+type GRM struct {
+	NSamples  int
+	NVariants int // Number of variants that passed the filters
+
+	values []float64
+	counts []uint32
+}
+
+func lowerTriangleIndex(i, j int) int {
+	if j > i {
+		i, j = j, i
+	}
+	return i*(i+1)/2 + j
+}
+
+// At returns the relationship between samples i and j.
+func (g *GRM) At(i, j int) float64 {
+	k := lowerTriangleIndex(i, j)
+	if g.counts[k] == 0 {
+		return math.NaN()
+	}
+	return g.values[k] / float64(g.counts[k])
+}
+
+// N returns the number of variants at which samples i and j were both
+// nonmissing.
+func (g *GRM) N(i, j int) int {
+	return int(g.counts[lowerTriangleIndex(i, j)])
+}
+
+// ComputeGRM streams every variant in b that passes the filters in opts and
+// accumulates the genetic relationship matrix. Memory use is proportional to
+// the square of the number of samples.
+func ComputeGRM(b *BGEN, opts GRMOptions) (*GRM, error) {
+	n := int(b.NSamples)
+	g := &GRM{
+		NSamples: n,
+		values:   make([]float64, n*(n+1)/2),
+		counts:   make([]uint32, n*(n+1)/2),
+	}
+
+	// Pairs involving a missing sample are counted separately so that
+	// variants without missingness can skip the per-pair count update.
+	missingPairs := make([]uint32, len(g.counts))
+	missingIdx := make([]int, 0, n)
+
+	s := newDosageStream(b, opts)
+	for {
+		ok, err := s.next()
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		if !ok {
+			break
+		}
+		g.NVariants++
+
+		x := s.x
+		k := 0
+		for i := 0; i < n; i++ {
+			xi := x[i]
+			if xi == 0 {
+				k += i + 1
+				continue
+			}
+			row := g.values[k : k+i+1]
+			for j := range row {
+				row[j] += xi * x[j]
+			}
+			k += i + 1
+		}
+
+		if s.nMiss == 0 {
+			continue
+		}
+		missingIdx = missingIdx[:0]
+		for i, m := range s.missing {
+			if m {
+				missingIdx = append(missingIdx, i)
+			}
+		}
+		for _, i := range missingIdx {
+			for j := 0; j < n; j++ {
+				// Avoid double counting pairs where both are missing
+				if s.missing[j] && j > i {
+					continue
+				}
+				missingPairs[lowerTriangleIndex(i, j)]++
+			}
+		}
+	}
+
+	for k := range g.counts {
+		g.counts[k] = uint32(g.NVariants) - missingPairs[k]
+	}
+
+	return g, nil
+}
+
+// WriteGCTA writes the GRM in the GCTA binary format: prefix.grm.bin and
+// prefix.grm.N.bin hold the lower triangle as little-endian float32 values,
+// and prefix.grm.id holds the family and individual IDs (both set to the
+// sample ID). samples must be in file order, as returned by ReadSamples.
+func (g *GRM) WriteGCTA(prefix string, samples []Sample) error {
+	if len(samples) != g.NSamples {
+		return pfx.Err(fmt.Errorf("Got %d samples, but the GRM has %d", len(samples), g.NSamples))
+	}
+
+	if err := writeFileWith(prefix+".grm.bin", func(w io.Writer) error {
+		return g.writeLowerTriangle(w, g.At)
+	}); err != nil {
+		return pfx.Err(err)
+	}
+
+	if err := writeFileWith(prefix+".grm.N.bin", func(w io.Writer) error {
+		return g.writeLowerTriangle(w, func(i, j int) float64 { return float64(g.N(i, j)) })
+	}); err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeFileWith(prefix+".grm.id", func(w io.Writer) error {
+		for _, s := range samples {
+			if _, err := fmt.Fprintf(w, "%s\t%s\n", s.SampleID, s.SampleID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (g *GRM) writeLowerTriangle(w io.Writer, value func(i, j int) float64) error {
+	buf := make([]byte, 4)
+	for i := 0; i < g.NSamples; i++ {
+		for j := 0; j <= i; j++ {
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(value(i, j))))
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileWith creates path, which may be a gs:// path, and hands a
+// buffered writer to fn, taking care of flushing and closing. If anything
+// fails, the file is abandoned rather than published.
+func writeFileWith(path string, fn func(w io.Writer) error) error {
+	f, err := createPath(context.Background(), path)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	if err := fn(bw); err != nil {
+		closeOrAbort(f)
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		closeOrAbort(f)
+		return err
+	}
+
+	return f.Close()
+}
@@ -0,0 +1,97 @@
+package bgen
+
+import (
+	"math"
+	"testing"
+)
+
+const exampleBGENPath = "example/limix/example.bgen"
+
+func TestComputeGRM(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	g, err := ComputeGRM(b, GRMOptions{MinMAF: 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if g.NVariants == 0 {
+		t.Fatal("No variants passed the filters")
+	}
+
+	var diag float64
+	for i := 0; i < g.NSamples; i++ {
+		diag += g.At(i, i)
+		if g.N(i, i) > g.NVariants {
+			t.Errorf("Sample %d has N=%d, more than the %d variants used", i, g.N(i, i), g.NVariants)
+		}
+	}
+	diag /= float64(g.NSamples)
+	if diag < 0.5 || diag > 1.5 {
+		t.Errorf("Mean GRM diagonal is %f, expected roughly 1", diag)
+	}
+
+	if g.At(3, 7) != g.At(7, 3) {
+		t.Errorf("GRM is not symmetric")
+	}
+}
+
+func TestRandomizedPCA(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	opts := PCAOptions{NComponents: 3, Oversample: 20, NIter: 30, Seed: 1}
+	res, err := RandomizedPCA(b, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Build G = XX'/M directly to check the eigenpairs.
+	n := int(b.NSamples)
+	g := newDenseMatrix(n, n)
+	s := newDosageStream(b, opts.GRMOptions)
+	var m int
+	for {
+		ok, err := s.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		m++
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				g.data[i*n+j] += s.x[i] * s.x[j]
+			}
+		}
+	}
+	if m != res.NVariants {
+		t.Fatalf("PCA used %d variants, expected %d", res.NVariants, m)
+	}
+
+	for k, lambda := range res.Eigenvalues {
+		if k > 0 && lambda > res.Eigenvalues[k-1] {
+			t.Errorf("Eigenvalues are not in descending order: %v", res.Eigenvalues)
+		}
+
+		var residual float64
+		for i := 0; i < n; i++ {
+			var gu float64
+			for j := 0; j < n; j++ {
+				gu += g.data[i*n+j] / float64(m) * res.Eigenvectors[j][k]
+			}
+			residual += math.Pow(gu-lambda*res.Eigenvectors[i][k], 2)
+		}
+		if math.Sqrt(residual)/lambda > 1e-3 {
+			t.Errorf("Component %d: relative residual %g is too large", k+1, math.Sqrt(residual)/lambda)
+		}
+	}
+}
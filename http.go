@@ -0,0 +1,201 @@
+package bgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/carbocation/genomisc"
+	"github.com/carbocation/pfx"
+)
+
+// httpClient is shared by every HTTP(S) reader so that connections to the
+// same host are reused across ranged reads and across files.
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
+var (
+	// httpMaxAttempts is the number of times a request is tried before its
+	// error is returned.
+	httpMaxAttempts = 5
+
+	// httpBaseDelay is the wait before the first retry. It doubles with each
+	// further retry, with up to 50% random jitter added.
+	httpBaseDelay = 200 * time.Millisecond
+)
+
+// httpReaderAt reads an object served over HTTP(S) with byte-range requests.
+type httpReaderAt struct {
+	ctx     context.Context
+	url     string
+	size    int64
+	modTime time.Time
+
+	// offset is the position of the next Read
+	offset int64
+}
+
+// openHTTP is the Opener for http:// and https:// paths. The server must
+// report the object's Content-Length and honor Range requests.
+func openHTTP(ctx context.Context, url string) (genomisc.ReaderAtCloser, error) {
+	r := &httpReaderAt{
+		ctx: ctx,
+		url: url,
+	}
+
+	var resp *http.Response
+	if err := httpDo(ctx, http.MethodHead, url, "", http.StatusOK, func(head *http.Response) error {
+		resp = head
+		return nil
+	}); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	if resp.ContentLength < 0 {
+		return nil, pfx.Err(fmt.Errorf("HEAD %s did not report a Content-Length", url))
+	}
+	r.size = resp.ContentLength
+
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		r.modTime, _ = http.ParseTime(lastModified)
+	}
+
+	return r, nil
+}
+
+// httpDo sends a request and hands a response with status want to read,
+// retrying with exponential backoff after network errors, 429 and 5xx
+// responses, and errors from read, such as a connection that drops mid-body.
+// Any other status is an error that is not retried. httpDo closes the body
+// after read returns.
+func httpDo(ctx context.Context, method, url, byteRange string, want int, read func(*http.Response) error) error {
+	var lastErr error
+
+	for attempt := 0; attempt < httpMaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := httpBaseDelay << (attempt - 1)
+			delay += time.Duration(rand.Int63n(int64(delay)/2 + 1))
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return err
+		}
+		if byteRange != "" {
+			req.Header.Set("Range", byteRange)
+		}
+
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode == want {
+			err := read(resp)
+			resp.Body.Close()
+			if err == nil || ctx.Err() != nil {
+				return err
+			}
+			lastErr = fmt.Errorf("Reading the response to %s %s: %w", method, url, err)
+			continue
+		}
+
+		// Drain the body so that the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+		resp.Body.Close()
+
+		lastErr = fmt.Errorf("%s %s returned %s", method, url, resp.Status)
+		if byteRange != "" {
+			lastErr = fmt.Errorf("%s %s with Range %s returned %s", method, url, byteRange, resp.Status)
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return lastErr
+		}
+	}
+
+	return fmt.Errorf("Gave up after %d attempts: %w", httpMaxAttempts, lastErr)
+}
+
+func (r *httpReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *httpReaderAt) ModTime() time.Time {
+	return r.modTime
+}
+
+func (r *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.ReadAtContext(r.ctx, p, off)
+}
+
+// ReadAtContext is like ReadAt, but uses ctx for the request instead of the
+// context that the reader was opened with.
+func (r *httpReaderAt) ReadAtContext(ctx context.Context, p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, pfx.Err(fmt.Errorf("Cannot read %s at negative offset %d", r.url, off))
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	want := p
+	if remaining := r.size - off; int64(len(want)) > remaining {
+		want = want[:remaining]
+	}
+
+	byteRange := fmt.Sprintf("bytes=%d-%d", off, off+int64(len(want))-1)
+
+	if err := httpDo(ctx, http.MethodGet, r.url, byteRange, http.StatusPartialContent, func(resp *http.Response) error {
+		_, err := io.ReadFull(resp.Body, want)
+		return err
+	}); err != nil {
+		return 0, pfx.Err(err)
+	}
+
+	if len(want) < len(p) {
+		return len(want), io.EOF
+	}
+
+	return len(want), nil
+}
+
+func (r *httpReaderAt) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.offset)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *httpReaderAt) Close() error {
+	return nil
+}
@@ -0,0 +1,186 @@
+package bgen
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// withFastRetries shortens the HTTP backoff for the duration of a test.
+func withFastRetries(t *testing.T) {
+	t.Helper()
+
+	delay := httpBaseDelay
+	httpBaseDelay = time.Millisecond
+	t.Cleanup(func() { httpBaseDelay = delay })
+}
+
+// flakyServer serves dir, failing every failEvery-th request with a 503.
+func flakyServer(t *testing.T, dir string, failEvery int64) (*httptest.Server, *int64) {
+	t.Helper()
+
+	var n int64
+	fileServer := http.FileServer(http.Dir(dir))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failEvery > 0 && atomic.AddInt64(&n, 1)%failEvery == 0 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &n
+}
+
+func TestHTTPRetries(t *testing.T) {
+	withFastRetries(t)
+
+	srv, _ := flakyServer(t, filepath.Dir(exampleBGENPath), 3)
+
+	local, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	remote, err := Open(srv.URL + "/" + filepath.Base(exampleBGENPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	compareProbabilities(t, local, remote, 0)
+}
+
+func TestHTTPGivesUp(t *testing.T) {
+	withFastRetries(t)
+
+	var n, status int64 = 0, http.StatusBadGateway
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&n, 1)
+		http.Error(w, "unavailable", int(atomic.LoadInt64(&status)))
+	}))
+	defer srv.Close()
+
+	if _, err := Open(srv.URL + "/example.bgen"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if n != int64(httpMaxAttempts) {
+		t.Errorf("Made %d attempts, expected %d", n, httpMaxAttempts)
+	}
+
+	// Client errors are not retried
+	atomic.StoreInt64(&n, 0)
+	atomic.StoreInt64(&status, http.StatusNotFound)
+	if _, err := Open(srv.URL + "/example.bgen"); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if n != 1 {
+		t.Errorf("Made %d attempts for a 404, expected 1", n)
+	}
+}
+
+func TestHTTPBodyRetries(t *testing.T) {
+	withFastRetries(t)
+
+	data := []byte("0123456789")
+	var gets, drops, unavailable int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", "10")
+			return
+		}
+		if atomic.AddInt64(&gets, 1)%2 == 1 && atomic.LoadInt64(&unavailable) != 0 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Length", "10")
+		w.Header().Set("Content-Range", "bytes 0-9/10")
+		w.WriteHeader(http.StatusPartialContent)
+
+		// Drop the connection after half of the body
+		if atomic.AddInt64(&drops, -1) >= 0 {
+			w.Write(data[:5])
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	r, err := openHTTP(context.Background(), srv.URL+"/example.bgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// One dropped body is retried like any other failure
+	atomic.StoreInt64(&drops, 1)
+	buf := make([]byte, 10)
+	if _, err := r.ReadAt(buf, 0); err != nil || string(buf) != string(data) {
+		t.Errorf("Got %q and error %v, expected %q", buf, err, data)
+	}
+	if gets != 2 {
+		t.Errorf("Made %d requests, expected 2", gets)
+	}
+
+	// Dropped bodies count against the same attempts as failed requests
+	atomic.StoreInt64(&gets, 0)
+	atomic.StoreInt64(&drops, 1<<20)
+	atomic.StoreInt64(&unavailable, 1)
+	if _, err := r.ReadAt(buf, 0); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if gets != int64(httpMaxAttempts) {
+		t.Errorf("Made %d requests, expected %d", gets, httpMaxAttempts)
+	}
+}
+
+func TestOpenBGIRemote(t *testing.T) {
+	requireSQLite(t)
+	withFastRetries(t)
+
+	dir := t.TempDir()
+	if err := CreateBGI(exampleBGENPath, filepath.Join(dir, "example.bgen.bgi")); err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := flakyServer(t, dir, 2)
+
+	bgi, err := OpenBGI(srv.URL + "/example.bgen.bgi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := bgi.AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 199 {
+		t.Errorf("Got %d rows, expected 199", len(rows))
+	}
+
+	local := sqliteFilename(t, bgi)
+	if err := bgi.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary copy %s to be removed, got %v", local, err)
+	}
+}
+
+// sqliteFilename returns the file that SQLite has open for bgi.
+func sqliteFilename(t *testing.T, bgi *BGIIndex) string {
+	t.Helper()
+
+	var seq int
+	var name, file string
+	if err := bgi.DB.QueryRow("PRAGMA database_list").Scan(&seq, &name, &file); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
@@ -0,0 +1,138 @@
+package bgen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/carbocation/pfx"
+)
+
+const (
+	// maxCoalesceGap is the largest run of unwanted bytes between two index
+	// rows that ReadIndexedBatch will read through rather than split into two
+	// reads.
+	maxCoalesceGap = 64 << 10
+
+	// maxCoalescedRead caps the size of a single coalesced read.
+	maxCoalescedRead = 64 << 20
+)
+
+// ReadIndexed reads the variant that row describes with a single read of
+// row.SizeInBytes bytes, and decodes it from memory. On remote files, this
+// is one request instead of one per field. Otherwise, it behaves like
+// ReadAt.
+func (vr *VariantReader) ReadIndexed(row VariantIndex) *Variant {
+	if vr.err != nil {
+		return nil
+	}
+
+	v, err := vr.readIndexed(row)
+	return vr.advance(v, int64(row.FileStartPosition+row.SizeInBytes), pfx.Err(err))
+}
+
+func (vr *VariantReader) readIndexed(row VariantIndex) (*Variant, error) {
+	if err := vr.checkIndexRow(row); err != nil {
+		return nil, err
+	}
+
+	block, err := vr.bytesAtOffset(int(row.SizeInBytes), int64(row.FileStartPosition))
+	if err == io.EOF {
+		// The row, not the file, has run out
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := vr.parseVariantBlock(block)
+	if err != nil {
+		return nil, fmt.Errorf("Index row for %s at offset %d: %w", row.RSID, row.FileStartPosition, err)
+	}
+
+	return v, nil
+}
+
+// checkIndexRow reports an error if row runs past the end of the file, so
+// that a stale or corrupt index cannot force an allocation of its size.
+func (vr *VariantReader) checkIndexRow(row VariantIndex) error {
+	fileSize := vr.knownFileSize()
+	if fileSize >= 0 && int64(row.FileStartPosition)+int64(row.SizeInBytes) > fileSize {
+		return fmt.Errorf("Index row for %s at offset %d has %d bytes, running past the end of the %d-byte file: %w", row.RSID, row.FileStartPosition, row.SizeInBytes, fileSize, io.ErrUnexpectedEOF)
+	}
+
+	return nil
+}
+
+// ReadIndexedBatch reads the variants that rows describe and returns them in
+// the same order as rows. Rows are sorted by file offset, and rows whose
+// blocks are adjacent or nearly so are fetched together with one large read,
+// which greatly reduces the number of requests made to remote files. As with
+// ReadIndexed, each variant counts toward VariantsSeen, the reader is left
+// after the last block in the file, and an error stops the reader.
+func (vr *VariantReader) ReadIndexedBatch(rows []VariantIndex) ([]*Variant, error) {
+	if vr.err != nil {
+		return nil, vr.err
+	}
+	for _, row := range rows {
+		if err := vr.checkIndexRow(row); err != nil {
+			vr.advance(nil, 0, pfx.Err(err))
+			return nil, vr.err
+		}
+	}
+
+	order := make([]int, len(rows))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return rows[order[i]].FileStartPosition < rows[order[j]].FileStartPosition
+	})
+
+	out := make([]*Variant, len(rows))
+
+	for first := 0; first < len(order); {
+		start := int64(rows[order[first]].FileStartPosition)
+		end := start + int64(rows[order[first]].SizeInBytes)
+
+		// Extend the span over every following row that starts close enough
+		// to its end
+		last := first + 1
+		for ; last < len(order); last++ {
+			row := rows[order[last]]
+			rowStart := int64(row.FileStartPosition)
+			rowEnd := rowStart + int64(row.SizeInBytes)
+			if rowStart > end+maxCoalesceGap || rowEnd-start > maxCoalescedRead {
+				break
+			}
+			if rowEnd > end {
+				end = rowEnd
+			}
+		}
+
+		span, err := vr.bytesAtOffset(int(end-start), start)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			vr.advance(nil, 0, pfx.Err(fmt.Errorf("Reading %d bytes at offset %d: %w", end-start, start, err)))
+			return nil, vr.err
+		}
+
+		for _, idx := range order[first:last] {
+			row := rows[idx]
+			blockStart := int64(row.FileStartPosition) - start
+
+			v, err := vr.parseVariantBlock(span[blockStart : blockStart+int64(row.SizeInBytes)])
+			if err != nil {
+				vr.advance(nil, 0, pfx.Err(fmt.Errorf("Index row for %s at offset %d: %w", row.RSID, row.FileStartPosition, err)))
+				return nil, vr.err
+			}
+			out[idx] = vr.advance(v, int64(row.FileStartPosition+row.SizeInBytes), nil)
+		}
+
+		first = last
+	}
+
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package bgen
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func TestReadIndexed(t *testing.T) {
+	rows, err := exampleBGI(t).AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &countingReaderAt{sectionReaderAtCloser: &sectionReaderAtCloser{SectionReader: newBytesSection(data)}}
+	b, err := OpenReaderAt(src, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := make([]*Variant, len(rows))
+	wr := b.NewVariantReader()
+	for i, row := range rows {
+		if want[i] = wr.ReadAt(int64(row.FileStartPosition)); wr.Error() != nil {
+			t.Fatal(wr.Error())
+		}
+	}
+
+	vr := b.NewVariantReader()
+	src.reads = 0
+	for i, row := range rows {
+		v := vr.ReadIndexed(row)
+		if err := vr.Error(); err != nil {
+			t.Fatal(err)
+		}
+		compareVariants(t, want[i], v)
+	}
+	if src.reads != int64(len(rows)) {
+		t.Errorf("ReadIndexed made %d reads for %d variants", src.reads, len(rows))
+	}
+
+	// Every other row, in shuffled order: the gaps are small enough to be
+	// read through, so this is still a single read
+	var subset []VariantIndex
+	var subsetWant []*Variant
+	for i := 0; i < len(rows); i += 2 {
+		subset = append(subset, rows[i])
+		subsetWant = append(subsetWant, want[i])
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(subset), func(i, j int) {
+		subset[i], subset[j] = subset[j], subset[i]
+		subsetWant[i], subsetWant[j] = subsetWant[j], subsetWant[i]
+	})
+
+	src.reads = 0
+	got, err := vr.ReadIndexedBatch(subset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.reads != 1 {
+		t.Errorf("ReadIndexedBatch made %d reads, expected 1", src.reads)
+	}
+	for i := range got {
+		compareVariants(t, subsetWant[i], got[i])
+	}
+	if vr.VariantsSeen != uint32(len(rows)+len(subset)) {
+		t.Errorf("VariantsSeen is %d after the batch, expected %d", vr.VariantsSeen, len(rows)+len(subset))
+	}
+	if lastRow := rows[len(rows)-1]; vr.currentOffset != uint32(lastRow.FileStartPosition+lastRow.SizeInBytes) {
+		t.Errorf("Reader is at offset %d after the batch, expected the end of the last block", vr.currentOffset)
+	}
+
+	// An index row with the wrong size is an error, not a misparse
+	bad := rows[3]
+	bad.SizeInBytes--
+	if v := b.NewVariantReader().ReadIndexed(bad); v != nil {
+		t.Error("Expected no variant from a truncated index row")
+	}
+	bad.SizeInBytes += 2
+	if _, err := vr.ReadIndexedBatch([]VariantIndex{bad}); err == nil {
+		t.Error("Expected an error from an oversized index row")
+	}
+	if vr.Error() == nil {
+		t.Error("Expected a failed batch to stop the reader")
+	}
+
+	// A row that runs past the end of the file is rejected before its size
+	// is allocated
+	huge := rows[3]
+	huge.SizeInBytes = 1 << 40
+	hr := b.NewVariantReader()
+	if v := hr.ReadIndexed(huge); v != nil || !errors.Is(hr.Error(), io.ErrUnexpectedEOF) {
+		t.Errorf("Got %v and error %v for a row past the end of the file, expected io.ErrUnexpectedEOF", v, hr.Error())
+	}
+	if _, err := b.NewVariantReader().ReadIndexedBatch([]VariantIndex{rows[0], huge}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Got error %v for a batch with a row past the end of the file, expected io.ErrUnexpectedEOF", err)
+	}
+	if _, err := extractDosageMatrix[float64](b, []VariantIndex{huge}, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Got error %v extracting dosages for a row past the end of the file, expected io.ErrUnexpectedEOF", err)
+	}
+	if v := vr.ReadIndexed(rows[0]); v != nil {
+		t.Error("Expected no variant from a reader stopped by a failed batch")
+	}
+	if _, err := vr.ReadIndexedBatch(rows[:1]); err == nil {
+		t.Error("Expected a batch on a stopped reader to return its error")
+	}
+}
+
+// compareVariants checks that two decoded variants are identical.
+func compareVariants(t *testing.T, want, got *Variant) {
+	t.Helper()
+
+	if got == nil {
+		t.Fatalf("Got no variant, expected %s", want.RSID)
+	}
+	if err := sameVariant(want, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.SampleProbabilities) != len(want.SampleProbabilities) {
+		t.Fatalf("Variant %s: got %d samples, expected %d", want.RSID, len(got.SampleProbabilities), len(want.SampleProbabilities))
+	}
+	for i, wsp := range want.SampleProbabilities {
+		gsp := got.SampleProbabilities[i]
+		if gsp.Missing != wsp.Missing || gsp.Ploidy != wsp.Ploidy || len(gsp.Probabilities) != len(wsp.Probabilities) {
+			t.Fatalf("Variant %s sample %d: got %+v, expected %+v", want.RSID, i, gsp, wsp)
+		}
+		for j := range wsp.Probabilities {
+			if gsp.Probabilities[j] != wsp.Probabilities[j] {
+				t.Fatalf("Variant %s sample %d: got %v, expected %v", want.RSID, i, gsp.Probabilities, wsp.Probabilities)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build go1.23
+
+package bgen
+
+import "iter"
+
+// All returns an iterator over every variant in file order. Iteration stops
+// after the first error, which is yielded with a nil Variant.
+func (b *BGEN) All() iter.Seq2[*Variant, error] {
+	return scannerSeq(b.NewScanner)
+}
+
+// Indexed returns an iterator over the variants that rows describe, such as
+// the result of BGIIndex.VariantsInRegion, in the order given. Iteration
+// stops after the first error, which is yielded with a nil Variant.
+func (b *BGEN) Indexed(rows []VariantIndex) iter.Seq2[*Variant, error] {
+	return scannerSeq(func() *Scanner { return b.NewIndexedScanner(rows) })
+}
+
+// scannerSeq adapts a fresh Scanner from newScanner for each iteration.
+func scannerSeq(newScanner func() *Scanner) iter.Seq2[*Variant, error] {
+	return func(yield func(*Variant, error) bool) {
+		s := newScanner()
+		for s.Next() {
+			if !yield(s.Variant(), nil) {
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+//go:build go1.23
+
+package bgen
+
+import "testing"
+
+func TestAll(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	n := 0
+	for v, err := range b.All() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.RSID == "" {
+			t.Fatal("Got a variant without an rsID")
+		}
+		n++
+	}
+	if n != 199 {
+		t.Errorf("Iterated over %d variants, expected 199", n)
+	}
+
+	// Stopping early and iterating again starts over
+	for v := range b.All() {
+		if v.RSID != "RSID_2" {
+			t.Errorf("Got %s first, expected RSID_2", v.RSID)
+		}
+		break
+	}
+
+	truncated, err := Open(truncatedExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer truncated.Close()
+
+	var last error
+	for _, err := range truncated.All() {
+		last = err
+	}
+	if last == nil {
+		t.Error("Expected the final element from a truncated file to be an error")
+	}
+}
+
+func TestIndexed(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	rows, err := exampleBGI(t).VariantsInRegion(Region{Chromosome: "01", Start: 2000, End: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	for v, err := range b.Indexed(rows) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.RSID != rows[n].RSID {
+			t.Errorf("Got %s, expected %s", v.RSID, rows[n].RSID)
+		}
+		n++
+	}
+	if n != len(rows) {
+		t.Errorf("Iterated over %d variants, expected %d", n, len(rows))
+	}
+}
@@ -0,0 +1,80 @@
+package bgen
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/carbocation/pfx"
+)
+
+// genotypeBufferPool recycles the buffers that hold undecoded genotype data.
+var genotypeBufferPool = sync.Pool{
+	New: func() interface{} { return new([]byte) },
+}
+
+type lazyGenotypes struct {
+	b        *BGEN
+	buf      *[]byte
+	released bool
+
+	// err is the error from a failed decode, which is returned again by
+	// later calls to Probabilities
+	err error
+}
+
+// newLazyGenotypes copies data, which may alias a reader's buffer or a
+// memory mapping, into a pooled buffer.
+func newLazyGenotypes(b *BGEN, data []byte) *lazyGenotypes {
+	buf := genotypeBufferPool.Get().(*[]byte)
+	*buf = append((*buf)[:0], data...)
+
+	return &lazyGenotypes{b: b, buf: buf}
+}
+
+// Probabilities returns the genotype probabilities of each sample. For a
+// Variant read by a Lazy VariantReader, the first call decodes them, fills
+// in SampleProbabilities and the other genotype fields, and returns the
+// undecoded data to a pool. Otherwise, it returns SampleProbabilities.
+func (v *Variant) Probabilities() ([]SampleProbability, error) {
+	if v.lazy == nil {
+		return v.SampleProbabilities, nil
+	}
+	if v.lazy.err != nil {
+		return nil, v.lazy.err
+	}
+	if v.lazy.released {
+		return nil, pfx.Err(fmt.Errorf("Variant %s was released before its probabilities were decoded", v.ID))
+	}
+
+	vr := &VariantReader{b: v.lazy.b}
+	err := vr.decodeGenotypes(v, *v.lazy.buf)
+	v.Release()
+	if err != nil {
+		v.lazy.err = pfx.Err(err)
+		return nil, v.lazy.err
+	}
+	v.lazy = nil
+
+	return v.SampleProbabilities, nil
+}
+
+// Release returns the undecoded genotype data of a Variant read by a Lazy
+// VariantReader to a pool for reuse. Call it for variants whose
+// probabilities will not be needed; Probabilities releases the data itself
+// once it has decoded it. Release has no effect on other variants.
+func (v *Variant) Release() {
+	if v.lazy == nil || v.lazy.released {
+		return
+	}
+
+	genotypeBufferPool.Put(v.lazy.buf)
+	v.lazy.buf = nil
+	v.lazy.released = true
+}
+
+// decoded ensures that the probabilities of a lazily read Variant have been
+// decoded, for functions that use SampleProbabilities directly.
+func (v *Variant) decoded() error {
+	_, err := v.Probabilities()
+	return err
+}
@@ -0,0 +1,88 @@
+package bgen
+
+import (
+	"testing"
+)
+
+func TestLazyProbabilities(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	eager := b.NewVariantReader()
+	lazy := b.NewVariantReader()
+	lazy.Lazy = true
+
+	for i := 0; ; i++ {
+		want, got := eager.Read(), lazy.Read()
+		if want == nil || got == nil {
+			if want != got {
+				t.Fatal("Readers returned different numbers of variants")
+			}
+			break
+		}
+
+		if got.RSID != want.RSID || len(got.SampleProbabilities) != 0 {
+			t.Fatalf("Variant %d: got %s with %d decoded samples, expected %s with none", i, got.RSID, len(got.SampleProbabilities), want.RSID)
+		}
+
+		// Decode every third variant and release the rest
+		if i%3 != 0 {
+			got.Release()
+			if _, err := got.Probabilities(); err == nil {
+				t.Fatal("Expected an error decoding a released variant")
+			}
+			continue
+		}
+
+		probs, err := got.Probabilities()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(probs) != len(want.SampleProbabilities) {
+			t.Fatalf("Variant %d: got %d samples, expected %d", i, len(probs), len(want.SampleProbabilities))
+		}
+		compareVariants(t, want, got)
+
+		// Decoding is idempotent, and Release after decoding is harmless
+		got.Release()
+		if again, err := got.Probabilities(); err != nil || len(again) != len(probs) {
+			t.Fatalf("Variant %d: second decode returned %d samples, error %v", i, len(again), err)
+		}
+	}
+	if eager.Error() != nil || lazy.Error() != nil {
+		t.Fatal(eager.Error(), lazy.Error())
+	}
+
+	// Functions that need probabilities decode them on demand
+	lazy = b.NewVariantReader()
+	lazy.Lazy = true
+	v := lazy.Read()
+	if _, err := ComputeVariantStats(v); err != nil {
+		t.Fatal(err)
+	}
+	if len(v.SampleProbabilities) != int(b.NSamples) {
+		t.Errorf("Got %d decoded samples, expected %d", len(v.SampleProbabilities), b.NSamples)
+	}
+}
+
+func BenchmarkReadLazyFilter(b *testing.B) {
+	bg := openExampleFile(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		vr := bg.NewVariantReader()
+		vr.Lazy = true
+		for v := vr.Read(); v != nil; v = vr.Read() {
+			// Decode one variant in ten, as a metadata filter might
+			if v.Position%10000 == 0 {
+				if _, err := v.Probabilities(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			v.Release()
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package bgen
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/carbocation/pfx"
+)
+
+// AccessPattern hints to OpenMmap how the file will be read, so that the
+// kernel can tune its read-ahead.
+type AccessPattern int
+
+const (
+	// AccessNormal uses the kernel's default read-ahead.
+	AccessNormal AccessPattern = iota
+
+	// AccessSequential suits scans from the first variant to the last.
+	AccessSequential
+
+	// AccessRandom suits scattered lookups, such as through an index.
+	AccessRandom
+)
+
+// byteSlicer is implemented by backends that can return file contents
+// without copying them.
+type byteSlicer interface {
+	slice(offset int64, n int) ([]byte, error)
+}
+
+// OpenMmap opens the local bgen file at path by mapping it into memory, so
+// that variants are parsed and decompressed directly from the mapping
+// without being copied. It is only supported on Linux.
+func OpenMmap(path string, access AccessPattern) (*BGEN, error) {
+	file, err := openMmap(path, access)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	b := &BGEN{
+		FilePath: path,
+		File:     file,
+	}
+
+	if err := populateBGENHeader(b); err != nil {
+		file.Close()
+		return nil, pfx.Err(err)
+	}
+
+	return b, nil
+}
+
+// mmapSlice returns n bytes of a mapped region without copying them.
+func mmapSlice(data []byte, offset int64, n int) ([]byte, error) {
+	if offset < 0 || n < 0 {
+		return nil, fmt.Errorf("Cannot read %d bytes at offset %d", n, offset)
+	}
+	if offset >= int64(len(data)) {
+		return nil, io.EOF
+	}
+	if end := offset + int64(n); end > int64(len(data)) {
+		return data[offset:], io.ErrUnexpectedEOF
+	}
+
+	return data[offset : offset+int64(n)], nil
+}
+
+// mmapReadAt copies from a mapped region with io.ReaderAt semantics.
+func mmapReadAt(data []byte, p []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, fmt.Errorf("Cannot read at negative offset %d", offset)
+	}
+	if offset >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, data[offset:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package bgen
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/carbocation/pfx"
+)
+
+// mmapFile is a read-only memory mapping of a whole file.
+type mmapFile struct {
+	f    *os.File
+	data []byte
+
+	// offset is the position of the next Read
+	offset int64
+}
+
+func openMmap(path string, access AccessPattern) (*mmapFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, pfx.Err(err)
+	}
+
+	m := &mmapFile{f: f}
+	if info.Size() == 0 {
+		// Empty files cannot be mapped
+		return m, nil
+	}
+
+	if m.data, err = syscall.Mmap(int(f.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED); err != nil {
+		f.Close()
+		return nil, pfx.Err(err)
+	}
+
+	advice := syscall.MADV_NORMAL
+	switch access {
+	case AccessSequential:
+		advice = syscall.MADV_SEQUENTIAL
+	case AccessRandom:
+		advice = syscall.MADV_RANDOM
+	}
+	if err := syscall.Madvise(m.data, advice); err != nil {
+		m.Close()
+		return nil, pfx.Err(err)
+	}
+
+	return m, nil
+}
+
+func (m *mmapFile) slice(offset int64, n int) ([]byte, error) {
+	return mmapSlice(m.data, offset, n)
+}
+
+func (m *mmapFile) ReadAt(p []byte, offset int64) (int, error) {
+	return mmapReadAt(m.data, p, offset)
+}
+
+func (m *mmapFile) Read(p []byte) (int, error) {
+	n, err := m.ReadAt(p, m.offset)
+	m.offset += int64(n)
+	return n, err
+}
+
+func (m *mmapFile) Stat() (os.FileInfo, error) {
+	return m.f.Stat()
+}
+
+func (m *mmapFile) Close() error {
+	var err error
+	if m.data != nil {
+		err = syscall.Munmap(m.data)
+		m.data = nil
+	}
+	if closeErr := m.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return pfx.Err(err)
+}
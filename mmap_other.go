@@ -0,0 +1,13 @@
+//go:build !linux
+
+package bgen
+
+import (
+	"fmt"
+
+	"github.com/carbocation/genomisc"
+)
+
+func openMmap(path string, access AccessPattern) (genomisc.ReaderAtCloser, error) {
+	return nil, fmt.Errorf("OpenMmap is only supported on Linux")
+}
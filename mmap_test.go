@@ -0,0 +1,104 @@
+package bgen
+
+import (
+	"runtime"
+	"testing"
+)
+
+func openExampleMmap(tb testing.TB, access AccessPattern) *BGEN {
+	tb.Helper()
+
+	if runtime.GOOS != "linux" {
+		tb.Skip("OpenMmap is only supported on Linux")
+	}
+
+	b, err := OpenMmap(exampleBGENPath, access)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+func TestOpenMmap(t *testing.T) {
+	b := openExampleMmap(t, AccessSequential)
+
+	local, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	compareProbabilities(t, local, b, 0)
+
+	samples, err := ReadSamples(b)
+	if err != nil || len(samples) != 500 {
+		t.Fatalf("Got %d samples, error %v", len(samples), err)
+	}
+
+	rows, err := exampleBGI(t).AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := openExampleMmap(t, AccessRandom)
+	got, err := random.NewVariantReader().ReadIndexedBatch(rows[10:20])
+	if err != nil {
+		t.Fatal(err)
+	}
+	vr := local.NewVariantReader()
+	for i, row := range rows[10:20] {
+		compareVariants(t, vr.ReadAt(int64(row.FileStartPosition)), got[i])
+	}
+
+	if report, err := Validate(b); err != nil || !report.OK() {
+		t.Errorf("Validate: %v %v", err, report)
+	}
+}
+
+func benchmarkReadAll(b *testing.B, open func(tb testing.TB) *BGEN) {
+	bg := open(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		vr := bg.NewVariantReader()
+		for v := vr.Read(); v != nil; v = vr.Read() {
+		}
+		if err := vr.Error(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkReadMetadata(b *testing.B, open func(tb testing.TB) *BGEN) {
+	bg := open(b)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		vr := bg.NewVariantReader()
+		for v := vr.ReadMetadata(); v != nil; v = vr.ReadMetadata() {
+		}
+		if err := vr.Error(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func openExampleFile(tb testing.TB) *BGEN {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+func openExampleMmapSequential(tb testing.TB) *BGEN {
+	return openExampleMmap(tb, AccessSequential)
+}
+
+func BenchmarkReadAllFile(b *testing.B)      { benchmarkReadAll(b, openExampleFile) }
+func BenchmarkReadAllMmap(b *testing.B)      { benchmarkReadAll(b, openExampleMmapSequential) }
+func BenchmarkReadMetadataFile(b *testing.B) { benchmarkReadMetadata(b, openExampleFile) }
+func BenchmarkReadMetadataMmap(b *testing.B) { benchmarkReadMetadata(b, openExampleMmapSequential) }
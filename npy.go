@@ -0,0 +1,319 @@
+package bgen
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/carbocation/pfx"
+)
+
+// NumPyDType is the element type of exported NumPy arrays.
+type NumPyDType int
+
+const (
+	NumPyFloat32 NumPyDType = iota
+	NumPyFloat16
+)
+
+func (d NumPyDType) descr() string {
+	if d == NumPyFloat16 {
+		return "<f2"
+	}
+	return "<f4"
+}
+
+func (d NumPyDType) size() int {
+	if d == NumPyFloat16 {
+		return 2
+	}
+	return 4
+}
+
+// encode stores x in the first d.size() bytes of buf.
+func (d NumPyDType) encode(buf []byte, x float64) {
+	if d == NumPyFloat16 {
+		binary.LittleEndian.PutUint16(buf, float16Bits(float32(x)))
+	} else {
+		binary.LittleEndian.PutUint32(buf, math.Float32bits(float32(x)))
+	}
+}
+
+// NumPyOptions controls ExportNumPy.
+type NumPyOptions struct {
+	DType NumPyDType
+
+	// Probabilities exports a samples x variants x genotypes tensor of
+	// genotype probabilities instead of a samples x variants matrix of
+	// dosages. Genotypes are in BGEN order; variants with fewer genotypes
+	// than the most of any variant are padded with NaN.
+	Probabilities bool
+
+	// NPZ writes a compressed .npz archive instead of a .npy file. The
+	// array is named "dosages" or "probabilities".
+	NPZ bool
+
+	// SampleIDs selects and orders the samples to export. If nil, every
+	// sample is exported in file order.
+	SampleIDs []string
+}
+
+// ExportNumPy writes the variants that rows describe (or every variant, if
+// rows is nil) to prefix.npy or prefix.npz, which can be read with np.load.
+// Missing values are NaN. Alongside, it writes prefix.variants.tsv, with one
+// line of metadata per variant in array order, and prefix.samples.tsv, with
+// one sample ID per line in array order. Samples in files without sample IDs
+// are named by their index.
+func ExportNumPy(b *BGEN, rows []VariantIndex, prefix string, opts NumPyOptions) error {
+	var samples []Sample
+	var err error
+	if b.FlagHasSampleIDs || opts.SampleIDs != nil {
+		if samples, err = ReadSamples(b); err != nil {
+			return pfx.Err(err)
+		}
+	} else {
+		samples = make([]Sample, b.NSamples)
+		for i := range samples {
+			samples[i].SampleID = strconv.Itoa(i)
+		}
+	}
+
+	columns := make([]int, len(samples))
+	for i := range columns {
+		columns[i] = i
+	}
+	sampleIDs := sampleIDStrings(samples)
+	if opts.SampleIDs != nil {
+		if columns, err = sampleIndicesInOrder(samples, opts.SampleIDs); err != nil {
+			return pfx.Err(err)
+		}
+		sampleIDs = opts.SampleIDs
+	}
+
+	var s *Scanner
+	nVariants := int(b.NVariants)
+	if rows != nil {
+		s = b.NewIndexedScanner(rows)
+		nVariants = len(rows)
+	} else {
+		s = b.NewScanner()
+	}
+
+	// Each column holds the values of one variant already encoded in the
+	// output type, so the array takes no more memory than the file it is
+	// written to
+	size := opts.DType.size()
+	var variants []*Variant
+	var values [][]byte
+	nGenotypes := 1
+	var dosages []float64
+	for s.Next() {
+		v := s.Variant()
+		if v.Phased {
+			return pfx.Err(fmt.Errorf("Variant %s is phased; only unphased variants can be exported", v.ID))
+		}
+
+		var column []byte
+		if opts.Probabilities {
+			column, nGenotypes = genotypeColumn(v, columns, nGenotypes, opts.DType)
+		} else {
+			if dosages, err = v.Dosages(dosages); err != nil {
+				return pfx.Err(err)
+			}
+			column = make([]byte, len(columns)*size)
+			for i, idx := range columns {
+				opts.DType.encode(column[i*size:], dosages[idx])
+			}
+		}
+
+		values = append(values, column)
+		v.SampleProbabilities = nil
+		variants = append(variants, v)
+	}
+	if err := s.Err(); err != nil {
+		return pfx.Err(err)
+	}
+	if len(variants) != nVariants {
+		return pfx.Err(fmt.Errorf("Read %d variants, expected %d", len(variants), nVariants))
+	}
+
+	name, shape := "dosages", []int{len(columns), len(variants)}
+	if opts.Probabilities {
+		name, shape = "probabilities", []int{len(columns), len(variants), nGenotypes}
+	}
+
+	// Element (i, j, k) of the C-ordered array is genotype k of sample i at
+	// variant j.
+	nan := make([]byte, size)
+	opts.DType.encode(nan, math.NaN())
+	elem := func(flat int) []byte {
+		if !opts.Probabilities {
+			i := flat / len(variants)
+			return values[flat%len(variants)][i*size : (i+1)*size]
+		}
+		k := flat % nGenotypes
+		j := (flat / nGenotypes) % len(variants)
+		i := flat / (nGenotypes * len(variants))
+		column := values[j]
+		if stride := len(column) / size / len(columns); k < stride {
+			return column[(i*stride+k)*size : (i*stride+k+1)*size]
+		}
+		return nan
+	}
+
+	writeArray := func(w io.Writer) error {
+		return writeNPY(w, opts.DType, shape, elem)
+	}
+	if opts.NPZ {
+		err = writeFileWith(prefix+".npz", func(w io.Writer) error {
+			zw := zip.NewWriter(w)
+			entry, err := zw.CreateHeader(&zip.FileHeader{Name: name + ".npy", Method: zip.Deflate})
+			if err != nil {
+				return err
+			}
+			if err := writeArray(entry); err != nil {
+				return err
+			}
+			return zw.Close()
+		})
+	} else {
+		err = writeFileWith(prefix+".npy", writeArray)
+	}
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	if err := writeFileWith(prefix+".variants.tsv", func(w io.Writer) error {
+		return writeVariantTSV(w, variants)
+	}); err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeFileWith(prefix+".samples.tsv", func(w io.Writer) error {
+		_, err := io.WriteString(w, "sample_id\n"+strings.Join(sampleIDs, "\n")+"\n")
+		return err
+	}))
+}
+
+// genotypeColumn flattens the genotype probabilities of the selected
+// samples, encoded as dtype, giving each sample the most genotypes of any of
+// them, padded with NaN. If v has more genotypes than nGenotypes, the
+// returned count is larger; narrower columns are padded when the array is
+// written.
+func genotypeColumn(v *Variant, columns []int, nGenotypes int, dtype NumPyDType) ([]byte, int) {
+	maxCombs := Choose(int(v.NAlleles)+int(v.MaximumPloidy)-1, int(v.NAlleles)-1)
+	if maxCombs > nGenotypes {
+		nGenotypes = maxCombs
+	}
+
+	size := dtype.size()
+	column := make([]byte, len(columns)*maxCombs*size)
+	for i, idx := range columns {
+		var probs []float64
+		if sp := v.SampleProbabilities[idx]; !sp.Missing && len(sp.Probabilities) > 0 {
+			probs = genotypeProbabilities(sp, int(v.NAlleles))
+		}
+
+		out := column[i*maxCombs*size : (i+1)*maxCombs*size]
+		for k := 0; k < maxCombs; k++ {
+			x := math.NaN()
+			if k < len(probs) {
+				x = probs[k]
+			}
+			dtype.encode(out[k*size:], x)
+		}
+	}
+
+	return column, nGenotypes
+}
+
+func writeVariantTSV(w io.Writer, variants []*Variant) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "chromosome\tposition\tid\trsid\talleles")
+	for _, v := range variants {
+		fmt.Fprintf(bw, "%s\t%d\t%s\t%s\t%s\n", v.Chromosome, v.Position, v.ID, v.RSID, JoinAlleles(v.Alleles))
+	}
+	return bw.Flush()
+}
+
+// writeNPY writes a C-ordered array in NPY format version 1.0, taking the
+// encoded value of each flat index from elem.
+func writeNPY(w io.Writer, dtype NumPyDType, shape []int, elem func(flat int) []byte) error {
+	dims := make([]string, len(shape))
+	n := 1
+	for i, d := range shape {
+		dims[i] = strconv.Itoa(d)
+		n *= d
+	}
+	shapeText := strings.Join(dims, ", ")
+	if len(shape) == 1 {
+		shapeText += ","
+	}
+
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': False, 'shape': (%s), }", dtype.descr(), shapeText)
+
+	// The magic string, version and header length take 10 bytes, and the
+	// header is padded with spaces and a newline to a multiple of 64.
+	padded := (10 + len(header) + 1 + 63) / 64 * 64
+	header += strings.Repeat(" ", padded-10-len(header)-1) + "\n"
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(bw, binary.LittleEndian, uint16(len(header)))
+	bw.WriteString(header)
+
+	for flat := 0; flat < n; flat++ {
+		if _, err := bw.Write(elem(flat)); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// float16Bits converts f to IEEE 754 half precision, rounding to nearest
+// even. Values too large become infinite and NaN stays NaN.
+func float16Bits(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff:
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15:
+		return sign | 0x7c00
+	case exp-127 >= -14:
+		// Normal: keep 10 bits of mantissa, rounding the 13 dropped bits
+		half := uint32(exp-127+15)<<10 | mant>>13
+		round := mant & 0x1fff
+		if round > 0x1000 || (round == 0x1000 && half&1 == 1) {
+			// A carry out of the mantissa correctly increments the exponent
+			half++
+		}
+		return sign | uint16(half)
+	case exp-127 >= -25:
+		// Subnormal: shift the mantissa, including its implicit leading
+		// bit, into place
+		mant |= 0x800000
+		shift := uint32(-14-(exp-127)) + 13
+		half := mant >> shift
+		round := mant & (1<<shift - 1)
+		midpoint := uint32(1) << (shift - 1)
+		if round > midpoint || (round == midpoint && half&1 == 1) {
+			half++
+		}
+		return sign | uint16(half)
+	}
+
+	return sign
+}
@@ -0,0 +1,266 @@
+package bgen
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readNPY parses a float32 or float16 NPY file, returning its header text
+// and values.
+func readNPY(t *testing.T, data []byte) (string, []float64) {
+	t.Helper()
+
+	if !bytes.HasPrefix(data, []byte("\x93NUMPY\x01\x00")) {
+		t.Fatalf("Missing NPY magic string: %q", data[:10])
+	}
+	headerLength := int(binary.LittleEndian.Uint16(data[8:10]))
+	if (10+headerLength)%64 != 0 {
+		t.Errorf("Header of %d bytes is not padded to a multiple of 64", headerLength)
+	}
+	header := string(data[10 : 10+headerLength])
+	body := data[10+headerLength:]
+
+	var out []float64
+	switch {
+	case strings.Contains(header, "'<f4'"):
+		for i := 0; i+4 <= len(body); i += 4 {
+			out = append(out, float64(math.Float32frombits(binary.LittleEndian.Uint32(body[i:]))))
+		}
+	case strings.Contains(header, "'<f2'"):
+		for i := 0; i+2 <= len(body); i += 2 {
+			out = append(out, float16ToFloat64(binary.LittleEndian.Uint16(body[i:])))
+		}
+	default:
+		t.Fatalf("Unexpected dtype in header %q", header)
+	}
+
+	return header, out
+}
+
+func float16ToFloat64(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * mant / 1024 * math.Pow(2, -14)
+	case 0x1f:
+		if mant != 0 {
+			return math.NaN()
+		}
+		return sign * math.Inf(1)
+	}
+
+	return sign * (1 + mant/1024) * math.Pow(2, float64(exp-15))
+}
+
+func TestFloat16Bits(t *testing.T) {
+	for _, c := range []struct {
+		in   float32
+		want uint16
+	}{
+		{0, 0x0000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{1e6, 0x7c00},
+		{float32(math.Pow(2, -24)), 0x0001},
+		{1 + 1.0/2048, 0x3c00}, // Ties round to even
+		{1 + 3.0/2048, 0x3c02},
+	} {
+		if got := float16Bits(c.in); got != c.want {
+			t.Errorf("float16Bits(%v) = %#04x, expected %#04x", c.in, got, c.want)
+		}
+	}
+
+	if got := float16Bits(float32(math.NaN())); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+		t.Errorf("float16Bits(NaN) = %#04x, expected a NaN", got)
+	}
+
+	for x := float32(0); x <= 2; x += 1.0 / 4096 {
+		if got := float16ToFloat64(float16Bits(x)); math.Abs(got-float64(x)) > 1.0/1024 {
+			t.Fatalf("%v round-tripped to %v", x, got)
+		}
+	}
+}
+
+func TestExportNumPy(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	rows, err := exampleBGI(t).VariantsInRegion(Region{Chromosome: "01", Start: 2000, End: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []string{"sample_003", "sample_001"}
+
+	vr := b.NewVariantReader()
+	var want []*Variant
+	for _, row := range rows {
+		want = append(want, vr.ReadIndexed(row))
+	}
+	fileIndex := []int{2, 0}
+
+	dir := t.TempDir()
+
+	// Dosages as float32 .npy
+	prefix := filepath.Join(dir, "dosages")
+	if err := ExportNumPy(b, rows, prefix, NumPyOptions{SampleIDs: samples}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(prefix + ".npy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, values := readNPY(t, data)
+	if !strings.Contains(header, "'shape': (2, 7)") || !strings.Contains(header, "'fortran_order': False") {
+		t.Errorf("Unexpected header %q", header)
+	}
+	for i := range samples {
+		for j, v := range want {
+			dosages, err := v.Dosages(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := values[i*len(want)+j]; math.Abs(got-dosages[fileIndex[i]]) > 1e-6 {
+				t.Errorf("Sample %d variant %d: got %v, expected %v", i, j, got, dosages[fileIndex[i]])
+			}
+		}
+	}
+
+	sidecar, err := os.ReadFile(prefix + ".samples.tsv")
+	if err != nil || string(sidecar) != "sample_id\nsample_003\nsample_001\n" {
+		t.Errorf("Unexpected samples sidecar %q (error %v)", sidecar, err)
+	}
+	sidecar, err = os.ReadFile(prefix + ".variants.tsv")
+	if lines := strings.Split(strings.TrimSpace(string(sidecar)), "\n"); err != nil || len(lines) != 8 || lines[1] != "01\t2000\tSNPID_2\tRSID_2\tA,G" {
+		t.Errorf("Unexpected variants sidecar %q (error %v)", sidecar, err)
+	}
+
+	// Probabilities as float16 .npz
+	prefix = filepath.Join(dir, "probabilities")
+	if err := ExportNumPy(b, rows, prefix, NumPyOptions{DType: NumPyFloat16, Probabilities: true, NPZ: true, SampleIDs: samples}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.OpenReader(prefix + ".npz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 1 || zr.File[0].Name != "probabilities.npy" {
+		t.Fatalf("Unexpected archive contents %v", zr.File)
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = io.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, values = readNPY(t, data)
+	if !strings.Contains(header, "'shape': (2, 7, 3)") || !strings.Contains(header, "'<f2'") {
+		t.Errorf("Unexpected header %q", header)
+	}
+	for i := range samples {
+		for j, v := range want {
+			sp := v.SampleProbabilities[fileIndex[i]]
+			for k := 0; k < 3; k++ {
+				got := values[(i*len(want)+j)*3+k]
+				if sp.Missing {
+					if !math.IsNaN(got) {
+						t.Errorf("Sample %d variant %d: got %v, expected NaN", i, j, got)
+					}
+				} else if math.Abs(got-sp.Probabilities[k]) > 1e-3 {
+					t.Errorf("Sample %d variant %d genotype %d: got %v, expected %v", i, j, k, got, sp.Probabilities[k])
+				}
+			}
+		}
+	}
+}
+
+func TestExportNumPyPadding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "padding.bgen")
+	w, err := Create(path, 2, WriterOptions{Layout: Layout2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*Variant{
+		{ID: "bi", Chromosome: "1", Position: 1, NAlleles: 2, Alleles: []Allele{"A", "G"}, SampleProbabilities: []SampleProbability{
+			{Ploidy: 2, Probabilities: []float64{1, 0, 0}},
+			{Ploidy: 2, Probabilities: []float64{0, 0, 1}},
+		}},
+		{ID: "tri", Chromosome: "1", Position: 2, NAlleles: 3, Alleles: []Allele{"A", "C", "G"}, SampleProbabilities: []SampleProbability{
+			{Ploidy: 2, Probabilities: []float64{0, 0, 0, 0, 0, 1}},
+			{Ploidy: 2, Probabilities: []float64{0, 1, 0, 0, 0, 0}},
+		}},
+	} {
+		if err := w.WriteVariant(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// The file has no sample IDs, so samples are named by their index
+	prefix := filepath.Join(t.TempDir(), "padding")
+	if err := ExportNumPy(b, nil, prefix, NumPyOptions{Probabilities: true}); err != nil {
+		t.Fatal(err)
+	}
+	sidecar, err := os.ReadFile(prefix + ".samples.tsv")
+	if err != nil || string(sidecar) != "sample_id\n0\n1\n" {
+		t.Errorf("Unexpected samples sidecar %q (error %v)", sidecar, err)
+	}
+	sidecar, err = os.ReadFile(prefix + ".variants.tsv")
+	if err != nil || !strings.HasSuffix(string(sidecar), "\ttri\t\tA,C,G\n") {
+		t.Errorf("Unexpected variants sidecar %q (error %v)", sidecar, err)
+	}
+
+	data, err := os.ReadFile(prefix + ".npy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, values := readNPY(t, data)
+	if !strings.Contains(header, "'shape': (2, 2, 6)") {
+		t.Fatalf("Unexpected header %q", header)
+	}
+
+	// The biallelic variant has 3 genotypes and is padded to 6 with NaN
+	nan := math.NaN()
+	want := []float64{
+		1, 0, 0, nan, nan, nan, 0, 0, 0, 0, 0, 1,
+		0, 0, 1, nan, nan, nan, 0, 1, 0, 0, 0, 0,
+	}
+	for i := range want {
+		if got := values[i]; got != want[i] && !(math.IsNaN(got) && math.IsNaN(want[i])) {
+			t.Errorf("Element %d: got %v, expected %v", i, got, want[i])
+		}
+	}
+
+	if err := ExportNumPy(b, nil, prefix, NumPyOptions{SampleIDs: []string{"0"}}); err == nil {
+		t.Error("Expected an error selecting sample IDs from a file without any")
+	}
+}
@@ -0,0 +1,358 @@
+package bgen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/carbocation/pfx"
+)
+
+// PCAOptions controls RandomizedPCA.
+type PCAOptions struct {
+	GRMOptions
+
+	// NComponents is the number of principal components to return.
+	NComponents int
+
+	// Oversample is the number of extra dimensions carried through the
+	// randomized subspace iteration to improve accuracy. Defaults to 10.
+	Oversample int
+
+	// NIter is the number of power iterations. Each one costs a full pass
+	// over the file. Defaults to 4.
+	NIter int
+
+	// Seed seeds the random starting subspace.
+	Seed int64
+}
+
+// PCAResult holds the top principal components of the standardized genotype
+// matrix. Eigenvalues are those of the GRM (XX'/M), in descending order, and
+// Eigenvectors[i][k] is the loading of sample i on component k.
+type PCAResult struct {
+	NVariants    int
+	Eigenvalues  []float64
+	Eigenvectors [][]float64
+}
+
+// RandomizedPCA computes the top principal components of the samples in b by
+// randomized subspace iteration. The genotype matrix is never materialized:
+// each iteration streams the file once and keeps only an NSamples x
+// (NComponents+Oversample) matrix in memory.
+func RandomizedPCA(b *BGEN, opts PCAOptions) (*PCAResult, error) {
+	if opts.NComponents < 1 {
+		return nil, pfx.Err(fmt.Errorf("NComponents must be at least 1, got %d", opts.NComponents))
+	}
+	if opts.Oversample <= 0 {
+		opts.Oversample = 10
+	}
+	if opts.NIter <= 0 {
+		opts.NIter = 4
+	}
+
+	n := int(b.NSamples)
+	l := opts.NComponents + opts.Oversample
+	if l > n {
+		l = n
+	}
+	if opts.NComponents > l {
+		return nil, pfx.Err(fmt.Errorf("Requested %d components from only %d samples", opts.NComponents, n))
+	}
+
+	// Random starting subspace in sample space. Since G = XX'/M is
+	// symmetric, the range finder can start directly from an n x l Gaussian.
+	rng := rand.New(rand.NewSource(opts.Seed))
+	q := newDenseMatrix(n, l)
+	for i := range q.data {
+		q.data[i] = rng.NormFloat64()
+	}
+	q.orthonormalize()
+
+	var nVariants int
+	for iter := 0; iter < opts.NIter; iter++ {
+		y := newDenseMatrix(n, l)
+		t := make([]float64, l)
+		var err error
+		nVariants, err = streamProjection(b, opts.GRMOptions, q, func(x []float64) {
+			// y += x (x'q)
+			q.leftMultiplyVector(x, t)
+			for i, xi := range x {
+				if xi == 0 {
+					continue
+				}
+				row := y.row(i)
+				for k := range row {
+					row[k] += xi * t[k]
+				}
+			}
+		})
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		q = y
+		q.orthonormalize()
+	}
+
+	// Project G onto the subspace: T = q'Gq = sum over variants of
+	// (x'q)'(x'q), divided by M.
+	tm := newDenseMatrix(l, l)
+	t := make([]float64, l)
+	nVariants, err := streamProjection(b, opts.GRMOptions, q, func(x []float64) {
+		q.leftMultiplyVector(x, t)
+		for a := 0; a < l; a++ {
+			row := tm.row(a)
+			for c := range row {
+				row[c] += t[a] * t[c]
+			}
+		}
+	})
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	if nVariants == 0 {
+		return nil, pfx.Err(fmt.Errorf("No variants passed the filters"))
+	}
+	for i := range tm.data {
+		tm.data[i] /= float64(nVariants)
+	}
+
+	values, vectors := symmetricEigen(tm)
+
+	out := &PCAResult{
+		NVariants:    nVariants,
+		Eigenvalues:  values[:opts.NComponents],
+		Eigenvectors: make([][]float64, n),
+	}
+	for i := 0; i < n; i++ {
+		out.Eigenvectors[i] = make([]float64, opts.NComponents)
+		qi := q.row(i)
+		for k := 0; k < opts.NComponents; k++ {
+			var sum float64
+			for a := 0; a < l; a++ {
+				sum += qi[a] * vectors.at(a, k)
+			}
+			out.Eigenvectors[i][k] = sum
+		}
+	}
+
+	return out, nil
+}
+
+// streamProjection calls fn with the standardized dosages of every variant
+// that passes the filters, returning the number of such variants.
+func streamProjection(b *BGEN, opts GRMOptions, q *denseMatrix, fn func(x []float64)) (int, error) {
+	s := newDosageStream(b, opts)
+	var nVariants int
+	for {
+		ok, err := s.next()
+		if err != nil {
+			return nVariants, pfx.Err(err)
+		}
+		if !ok {
+			break
+		}
+		nVariants++
+		fn(s.x)
+	}
+
+	return nVariants, nil
+}
+
+// WriteEigenvec writes the eigenvectors as a tab-delimited file with a
+// header, in the style of PLINK's .eigenvec: FID, IID, then PC1..PCk.
+func (p *PCAResult) WriteEigenvec(w io.Writer, samples []Sample) error {
+	if len(samples) != len(p.Eigenvectors) {
+		return pfx.Err(fmt.Errorf("Got %d samples, but the PCA has %d", len(samples), len(p.Eigenvectors)))
+	}
+
+	header := []string{"FID", "IID"}
+	for k := range p.Eigenvalues {
+		header = append(header, fmt.Sprintf("PC%d", k+1))
+	}
+	if _, err := fmt.Fprintln(w, strings.Join(header, "\t")); err != nil {
+		return pfx.Err(err)
+	}
+
+	fields := make([]string, 0, len(header))
+	for i, s := range samples {
+		fields = append(fields[:0], s.SampleID, s.SampleID)
+		for _, v := range p.Eigenvectors[i] {
+			fields = append(fields, fmt.Sprintf("%g", v))
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(fields, "\t")); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	return nil
+}
+
+// WriteEigenval writes one eigenvalue per line.
+func (p *PCAResult) WriteEigenval(w io.Writer) error {
+	for _, v := range p.Eigenvalues {
+		if _, err := fmt.Fprintf(w, "%g\n", v); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	return nil
+}
+
+// WriteFiles writes prefix.eigenvec with WriteEigenvec, and then
+// prefix.eigenval with WriteEigenval. samples must be in file order, as
+// returned by ReadSamples.
+func (p *PCAResult) WriteFiles(prefix string, samples []Sample) error {
+	if err := writeFileWith(prefix+".eigenvec", func(w io.Writer) error {
+		return p.WriteEigenvec(w, samples)
+	}); err != nil {
+		return pfx.Err(err)
+	}
+
+	return pfx.Err(writeFileWith(prefix+".eigenval", p.WriteEigenval))
+}
+
+// denseMatrix is a minimal row-major matrix, sufficient for the small
+// linear algebra needed by RandomizedPCA.
+type denseMatrix struct {
+	rows, cols int
+	data       []float64
+}
+
+func newDenseMatrix(rows, cols int) *denseMatrix {
+	return &denseMatrix{rows: rows, cols: cols, data: make([]float64, rows*cols)}
+}
+
+func (m *denseMatrix) row(i int) []float64 {
+	return m.data[i*m.cols : (i+1)*m.cols : (i+1)*m.cols]
+}
+
+func (m *denseMatrix) at(i, j int) float64 {
+	return m.data[i*m.cols+j]
+}
+
+// leftMultiplyVector stores x'm in dst.
+func (m *denseMatrix) leftMultiplyVector(x, dst []float64) {
+	for k := range dst {
+		dst[k] = 0
+	}
+	for i, xi := range x {
+		if xi == 0 {
+			continue
+		}
+		row := m.row(i)
+		for k, v := range row {
+			dst[k] += xi * v
+		}
+	}
+}
+
+// orthonormalize replaces the columns of m with an orthonormal basis for
+// their span, using modified Gram-Schmidt with one round of
+// reorthogonalization. Columns that become numerically zero are replaced by
+// zeros.
+func (m *denseMatrix) orthonormalize() {
+	col := make([]float64, m.rows)
+	for k := 0; k < m.cols; k++ {
+		for i := range col {
+			col[i] = m.at(i, k)
+		}
+		for pass := 0; pass < 2; pass++ {
+			for j := 0; j < k; j++ {
+				var dot float64
+				for i := range col {
+					dot += col[i] * m.at(i, j)
+				}
+				for i := range col {
+					col[i] -= dot * m.at(i, j)
+				}
+			}
+		}
+		var norm float64
+		for _, v := range col {
+			norm += v * v
+		}
+		norm = math.Sqrt(norm)
+		for i := range col {
+			if norm > 1e-300 {
+				m.data[i*m.cols+k] = col[i] / norm
+			} else {
+				m.data[i*m.cols+k] = 0
+			}
+		}
+	}
+}
+
+// symmetricEigen computes the eigendecomposition of the symmetric matrix a
+// with the cyclic Jacobi method. Eigenvalues are returned in descending order
+// and the k'th column of the returned matrix is the matching eigenvector.
+func symmetricEigen(a *denseMatrix) ([]float64, *denseMatrix) {
+	n := a.rows
+	w := newDenseMatrix(n, n)
+	copy(w.data, a.data)
+	v := newDenseMatrix(n, n)
+	for i := 0; i < n; i++ {
+		v.data[i*n+i] = 1
+	}
+
+	for sweep := 0; sweep < 100; sweep++ {
+		var off float64
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				off += w.at(p, q) * w.at(p, q)
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				apq := w.at(p, q)
+				if apq == 0 {
+					continue
+				}
+				theta := (w.at(q, q) - w.at(p, p)) / (2 * apq)
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < n; k++ {
+					akp, akq := w.at(k, p), w.at(k, q)
+					w.data[k*n+p] = c*akp - s*akq
+					w.data[k*n+q] = s*akp + c*akq
+				}
+				for k := 0; k < n; k++ {
+					apk, aqk := w.at(p, k), w.at(q, k)
+					w.data[p*n+k] = c*apk - s*aqk
+					w.data[q*n+k] = s*apk + c*aqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := v.at(k, p), v.at(k, q)
+					v.data[k*n+p] = c*vkp - s*vkq
+					v.data[k*n+q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return w.at(order[i], order[i]) > w.at(order[j], order[j]) })
+
+	values := make([]float64, n)
+	vectors := newDenseMatrix(n, n)
+	for k, idx := range order {
+		values[k] = w.at(idx, idx)
+		for i := 0; i < n; i++ {
+			vectors.data[i*n+k] = v.at(i, idx)
+		}
+	}
+
+	return values, vectors
+}
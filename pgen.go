@@ -0,0 +1,284 @@
+package bgen
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/carbocation/pfx"
+)
+
+const (
+	// pgenModeDosage is the PLINK 2 fixed-width storage mode whose records
+	// hold 2-bit hard calls followed by a 16-bit dosage per sample.
+	pgenModeDosage = 0x03
+
+	// pgenHeaderSize covers the magic number, storage mode, variant and
+	// sample counts, and the header control byte.
+	pgenHeaderSize = 12
+
+	// pgenProvisionalRef is the header control byte that marks every REF
+	// allele as provisional, since BGEN does not say which allele is the
+	// reference.
+	pgenProvisionalRef = 1 << 6
+
+	// pgenDosageScale is the stored dosage of one ALT allele. Two copies are
+	// stored as 32768, and missing dosages as 65535.
+	pgenDosageScale   = 16384
+	pgenDosageMissing = 0xffff
+)
+
+// DefaultPGENHardCallThreshold is PLINK 2's default hard call threshold.
+const DefaultPGENHardCallThreshold = 0.1
+
+// PGENOptions controls ExportPGEN.
+type PGENOptions struct {
+	// HardCallThreshold is the largest distance between a dosage and the
+	// nearest whole number for which a hard call is saved; further away, the
+	// hard call is missing, though the dosage is kept. Zero saves hard calls
+	// only for whole-number dosages. If nil, DefaultPGENHardCallThreshold is
+	// used.
+	HardCallThreshold *float64
+}
+
+// PGENStats summarizes a call to ExportPGEN.
+type PGENStats struct {
+	NVariants int
+
+	// NSkippedMultiallelic counts the variants with more than two alleles,
+	// which are not written.
+	NSkippedMultiallelic int
+}
+
+// ExportPGEN writes every remaining variant from src as a PLINK 2 fileset:
+// prefix.pgen with hard calls and dosages, prefix.pvar with the variant
+// metadata and prefix.psam with the sample IDs, of which there must be one
+// for each of the nSamples samples in the source's header.
+//
+// The .pgen file uses PLINK 2's fixed-width dosage storage mode. The first
+// allele is written as REF, marked provisional, and the second as ALT, with
+// dosages counting the ALT allele. Multi-allelic variants are skipped and
+// counted in the returned stats, since PLINK 2 cannot yet store their
+// dosages; split them into biallelic records first to keep them. Haploid
+// samples are written as homozygous, as PLINK 2 does. Phased variants and
+// ploidies above two are rejected.
+func ExportPGEN(src VariantSource, nSamples uint32, samples []Sample, prefix string, opts PGENOptions) (*PGENStats, error) {
+	threshold := DefaultPGENHardCallThreshold
+	if opts.HardCallThreshold != nil {
+		threshold = *opts.HardCallThreshold
+	}
+	if threshold < 0 || math.IsNaN(threshold) {
+		return nil, pfx.Err(fmt.Errorf("HardCallThreshold must not be negative, got %v", threshold))
+	}
+	if len(samples) != int(nSamples) {
+		return nil, pfx.Err(fmt.Errorf("Got %d sample IDs, but the file has %d samples", len(samples), nSamples))
+	}
+
+	// The three files are published together: a failure in any of them
+	// abandons the others, so that no partial fileset is left behind on
+	// gs://
+	var outputs []Output
+	abort := func() {
+		for _, out := range outputs {
+			out.Abort()
+		}
+	}
+	for _, suffix := range []string{".pgen", ".pvar", ".psam"} {
+		out, err := CreateOutput(prefix + suffix)
+		if err != nil {
+			abort()
+			return nil, pfx.Err(err)
+		}
+		outputs = append(outputs, out)
+	}
+	pgen, pvar, psam := outputs[0], outputs[1], outputs[2]
+
+	psamWriter := bufio.NewWriter(psam)
+	if err := writePSAM(psamWriter, samples); err != nil {
+		abort()
+		return nil, pfx.Err(err)
+	}
+	if err := psamWriter.Flush(); err != nil {
+		abort()
+		return nil, pfx.Err(err)
+	}
+
+	stats, err := writePGEN(src, int(nSamples), pgen, pvar, threshold)
+	if err != nil {
+		abort()
+		return nil, pfx.Err(err)
+	}
+
+	for i, out := range outputs {
+		if err := out.Close(); err != nil {
+			for _, rest := range outputs[i+1:] {
+				rest.Abort()
+			}
+			return nil, pfx.Err(err)
+		}
+	}
+
+	return stats, nil
+}
+
+func writePSAM(w io.Writer, samples []Sample) error {
+	if _, err := io.WriteString(w, "#IID\n"); err != nil {
+		return err
+	}
+	for _, s := range samples {
+		if _, err := fmt.Fprintln(w, s.SampleID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writePGEN streams the .pgen records and .pvar lines, and then fills in the
+// variant count in the .pgen header.
+func writePGEN(src VariantSource, nSamples int, pgen io.WriteSeeker, pvar io.Writer, threshold float64) (*PGENStats, error) {
+	pgenWriter := bufio.NewWriterSize(pgen, 1<<20)
+	pvarWriter := bufio.NewWriterSize(pvar, 1<<20)
+
+	header := make([]byte, pgenHeaderSize)
+	header[0], header[1], header[2] = 0x6c, 0x1b, pgenModeDosage
+	binary.LittleEndian.PutUint32(header[7:], uint32(nSamples))
+	header[11] = pgenProvisionalRef
+	if _, err := pgenWriter.Write(header); err != nil {
+		return nil, err
+	}
+
+	if _, err := io.WriteString(pvarWriter, "#CHROM\tPOS\tID\tREF\tALT\n"); err != nil {
+		return nil, err
+	}
+
+	stats := &PGENStats{}
+	record := make([]byte, (nSamples+3)/4+2*nSamples)
+	var dosages []float64
+
+	for v := src.Read(); v != nil; v = src.Read() {
+		if v.NAlleles > 2 {
+			stats.NSkippedMultiallelic++
+			continue
+		}
+
+		var err error
+		if dosages, err = pgenDosages(v, dosages); err != nil {
+			return nil, err
+		}
+		if len(dosages) != nSamples {
+			return nil, fmt.Errorf("Variant %s has %d samples, but %d sample IDs were given", v.ID, len(dosages), nSamples)
+		}
+		encodePGENRecord(record, dosages, threshold)
+		if _, err := pgenWriter.Write(record); err != nil {
+			return nil, err
+		}
+
+		alt := "."
+		if len(v.Alleles) > 1 {
+			alt = v.Alleles[1].String()
+		}
+		id := v.RSID
+		if id == "" {
+			id = genField(v.ID)
+		}
+		if _, err := fmt.Fprintf(pvarWriter, "%s\t%d\t%s\t%s\t%s\n", v.Chromosome, v.Position, id, v.Alleles[0], alt); err != nil {
+			return nil, err
+		}
+		stats.NVariants++
+	}
+	if err := src.Error(); err != nil {
+		return nil, err
+	}
+
+	if err := pgenWriter.Flush(); err != nil {
+		return nil, err
+	}
+	if err := pvarWriter.Flush(); err != nil {
+		return nil, err
+	}
+
+	binary.LittleEndian.PutUint32(header[3:], uint32(stats.NVariants))
+	if _, err := pgen.Seek(3, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := pgen.Write(header[3:7]); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// pgenDosages returns the ALT allele dosage of each sample on PLINK 2's
+// diploid scale, with NaN for missing samples.
+func pgenDosages(v *Variant, dst []float64) ([]float64, error) {
+	if v.NAlleles == 0 {
+		return nil, fmt.Errorf("Variant %s has no alleles", v.ID)
+	}
+	if v.NAlleles == 1 {
+		// A monomorphic site has no ALT allele to count. A lazy variant only
+		// has its samples once it is decoded.
+		if err := v.decoded(); err != nil {
+			return nil, err
+		}
+		if cap(dst) < len(v.SampleProbabilities) {
+			dst = make([]float64, len(v.SampleProbabilities))
+		}
+		dst = dst[:len(v.SampleProbabilities)]
+		for i, sp := range v.SampleProbabilities {
+			dst[i] = 0
+			if sp.Missing {
+				dst[i] = math.NaN()
+			}
+		}
+		return dst, nil
+	}
+
+	dst, err := v.Dosages(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, sp := range v.SampleProbabilities {
+		switch {
+		case sp.Missing:
+		case sp.Ploidy == 1:
+			dst[i] *= 2
+		case sp.Ploidy != 2:
+			return nil, fmt.Errorf("Sample %d of variant %s has ploidy %d; only haploid and diploid samples can be exported to PGEN", i, v.ID, sp.Ploidy)
+		}
+	}
+
+	return dst, nil
+}
+
+// encodePGENRecord fills record with the hard calls (2 bits per sample, the
+// first sample in the lowest bits, with 0-2 counting ALT alleles and 3 meaning
+// missing) followed by the 16-bit dosages.
+func encodePGENRecord(record []byte, dosages []float64, threshold float64) {
+	nGenotypeBytes := (len(dosages) + 3) / 4
+	for i := range record[:nGenotypeBytes] {
+		record[i] = 0
+	}
+	dosageBytes := record[nGenotypeBytes:]
+
+	for i, d := range dosages {
+		call, stored := uint8(3), uint16(pgenDosageMissing)
+		if !math.IsNaN(d) {
+			if d < 0 {
+				d = 0
+			} else if d > 2 {
+				d = 2
+			}
+			if nearest := math.Round(d); math.Abs(d-nearest) <= threshold {
+				call = uint8(nearest)
+			}
+			stored = uint16(math.Round(d * pgenDosageScale))
+		}
+
+		record[i/4] |= call << (2 * uint(i%4))
+		binary.LittleEndian.PutUint16(dosageBytes[2*i:], stored)
+	}
+}
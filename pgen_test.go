@@ -0,0 +1,374 @@
+package bgen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExportPGEN(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	samples, err := ReadSamples(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := filepath.Join(t.TempDir(), "example")
+	if _, err := ExportPGEN(b.NewVariantReader(), b.NSamples, samples[1:], prefix, PGENOptions{}); err == nil {
+		t.Errorf("Expected an error for too few sample IDs")
+	}
+	negative := -0.1
+	if _, err := ExportPGEN(b.NewVariantReader(), b.NSamples, samples, prefix, PGENOptions{HardCallThreshold: &negative}); err == nil {
+		t.Errorf("Expected an error for a negative hard call threshold")
+	}
+
+	stats, err := ExportPGEN(b.NewVariantReader(), b.NSamples, samples, prefix, PGENOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NVariants != int(b.NVariants) || stats.NSkippedMultiallelic != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	pgen, err := os.ReadFile(prefix + ".pgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := int(b.NSamples)
+	recordSize := (n+3)/4 + 2*n
+	if pgen[0] != 0x6c || pgen[1] != 0x1b || pgen[2] != 0x03 {
+		t.Fatalf("Unexpected magic number and storage mode %x", pgen[:3])
+	}
+	if m := binary.LittleEndian.Uint32(pgen[3:]); m != b.NVariants {
+		t.Errorf("Header has %d variants, expected %d", m, b.NVariants)
+	}
+	if got := binary.LittleEndian.Uint32(pgen[7:]); got != b.NSamples {
+		t.Errorf("Header has %d samples, expected %d", got, b.NSamples)
+	}
+	if len(pgen) != pgenHeaderSize+int(b.NVariants)*recordSize {
+		t.Fatalf("File has %d bytes, expected %d", len(pgen), pgenHeaderSize+int(b.NVariants)*recordSize)
+	}
+
+	vr := b.NewVariantReader()
+	var nMissingCalls int
+	for j := 0; ; j++ {
+		v := vr.Read()
+		if v == nil {
+			break
+		}
+		want, err := v.Dosages(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		record := pgen[pgenHeaderSize+j*recordSize : pgenHeaderSize+(j+1)*recordSize]
+		for i, d := range want {
+			call := record[i/4] >> (2 * uint(i%4)) & 3
+			stored := binary.LittleEndian.Uint16(record[(n+3)/4+2*i:])
+
+			if math.IsNaN(d) {
+				if call != 3 || stored != 0xffff {
+					t.Fatalf("Variant %d sample %d: expected missing, got call %d and dosage %d", j, i, call, stored)
+				}
+				continue
+			}
+			if math.Abs(float64(stored)/16384-d) > 0.5/16384 {
+				t.Fatalf("Variant %d sample %d: got dosage %d, expected %v", j, i, stored, d)
+			}
+			if call == 3 {
+				nMissingCalls++
+				if math.Abs(d-math.Round(d)) <= 0.1 {
+					t.Fatalf("Variant %d sample %d: no hard call for dosage %v", j, i, d)
+				}
+			} else if float64(call) != math.Round(d) {
+				t.Fatalf("Variant %d sample %d: got hard call %d for dosage %v", j, i, call, d)
+			}
+		}
+	}
+	if nMissingCalls == 0 {
+		t.Errorf("Expected some uncertain dosages to have no hard call")
+	}
+
+	pvar, err := os.ReadFile(prefix + ".pvar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(pvar)), "\n")
+	if len(lines) != int(b.NVariants)+1 || lines[0] != "#CHROM\tPOS\tID\tREF\tALT" || lines[1] != "01\t2000\tRSID_2\tA\tG" {
+		t.Errorf("Unexpected .pvar beginning with %q", lines[:3])
+	}
+
+	psam, err := os.ReadFile(prefix + ".psam")
+	if err != nil || !strings.HasPrefix(string(psam), "#IID\nsample_001\nsample_002\n") {
+		t.Errorf("Unexpected .psam %q (error %v)", psam, err)
+	}
+}
+
+func TestExportPGENMultiallelic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "multi.bgen")
+	w, err := Create(path, 2, WriterOptions{Layout: Layout2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*Variant{
+		{ID: "tri", Chromosome: "1", Position: 1, NAlleles: 3, Alleles: []Allele{"A", "C", "G"}, SampleProbabilities: []SampleProbability{
+			{Ploidy: 2, Probabilities: []float64{1, 0, 0, 0, 0, 0}},
+			{Ploidy: 2, Probabilities: []float64{0, 0, 0, 0, 0, 1}},
+		}},
+		{ID: "x", Chromosome: "X", Position: 2, NAlleles: 2, Alleles: []Allele{"A", "T"}, SampleProbabilities: []SampleProbability{
+			{Ploidy: 1, Probabilities: []float64{0, 1}},
+			{Ploidy: 2, Probabilities: []float64{0, 1, 0}},
+		}},
+	} {
+		if err := w.WriteVariant(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	prefix := filepath.Join(t.TempDir(), "multi")
+	stats, err := ExportPGEN(b.NewVariantReader(), b.NSamples, []Sample{{"a"}, {"b"}}, prefix, PGENOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NVariants != 1 || stats.NSkippedMultiallelic != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	pgen, err := os.ReadFile(prefix + ".pgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The haploid ALT call is written as homozygous
+	if record := pgen[pgenHeaderSize:]; record[0] != 2|1<<2 || binary.LittleEndian.Uint16(record[1:]) != 32768 || binary.LittleEndian.Uint16(record[3:]) != 16384 {
+		t.Errorf("Unexpected record %x", record)
+	}
+}
+
+func TestExportPGENLazy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mono.bgen")
+	w, err := Create(path, 2, WriterOptions{Layout: Layout2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteVariant(&Variant{ID: "mono", Chromosome: "1", Position: 1, NAlleles: 1, Alleles: []Allele{"A"}, SampleProbabilities: []SampleProbability{
+		{Ploidy: 2, Probabilities: []float64{1}},
+		{Ploidy: 2, Missing: true, Probabilities: []float64{0}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var records [][]byte
+	for _, lazy := range []bool{false, true} {
+		vr := b.NewVariantReader()
+		vr.Lazy = lazy
+		prefix := filepath.Join(t.TempDir(), "mono")
+		if _, err := ExportPGEN(vr, b.NSamples, []Sample{{"a"}, {"b"}}, prefix, PGENOptions{}); err != nil {
+			t.Fatalf("Lazy %v: %v", lazy, err)
+		}
+		pgen, err := os.ReadFile(prefix + ".pgen")
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, pgen[pgenHeaderSize:])
+	}
+
+	// The first sample is homozygous REF and the second missing
+	want := []byte{0 | 3<<2, 0x00, 0x00, 0xff, 0xff}
+	for i, record := range records {
+		if !bytes.Equal(record, want) {
+			t.Errorf("Lazy %v: got record % x, expected % x", i == 1, record, want)
+		}
+	}
+}
+
+// runPlink2 runs plink2 on a fileset written by ExportPGEN, so that the
+// output is checked by PLINK 2's own reader rather than by this package. The
+// test is skipped if plink2 is not on the PATH.
+func runPlink2(t *testing.T, args ...string) {
+	t.Helper()
+
+	plink2, err := exec.LookPath("plink2")
+	if err != nil {
+		t.Skip("plink2 is not installed")
+	}
+	if out, err := exec.Command(plink2, args...).CombinedOutput(); err != nil {
+		t.Fatalf("plink2 %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// readPlink2Table reads a whitespace-separated table written by plink2,
+// keyed by the column names in its first line.
+func readPlink2Table(t *testing.T, path string) (header []string, rows [][]string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	header = strings.Fields(strings.TrimPrefix(lines[0], "#"))
+	for _, line := range lines[1:] {
+		rows = append(rows, strings.Fields(line))
+	}
+
+	return header, rows
+}
+
+func column(t *testing.T, header []string, name string) int {
+	t.Helper()
+
+	for i, h := range header {
+		if h == name {
+			return i
+		}
+	}
+	t.Fatalf("plink2 output has no %s column: %v", name, header)
+	return -1
+}
+
+// TestExportPGENPlink2 reads an exported fileset back with plink2 and
+// compares its dosages and hard-call genotype counts with the BGEN source.
+func TestExportPGENPlink2(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	samples, err := ReadSamples(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want [][]float64
+	var rsids []string
+	var alleles [][]Allele
+	vr := b.NewVariantReader()
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		d, err := v.Dosages(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, d)
+		rsids = append(rsids, v.RSID)
+		alleles = append(alleles, v.Alleles)
+	}
+	if vr.Error() != nil {
+		t.Fatal(vr.Error())
+	}
+
+	zero := 0.0
+	for _, test := range []struct {
+		name      string
+		threshold *float64
+	}{
+		{"default", nil},
+		{"zero", &zero},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			prefix := filepath.Join(dir, "example")
+			if _, err := ExportPGEN(b.NewVariantReader(), b.NSamples, samples, prefix, PGENOptions{HardCallThreshold: test.threshold}); err != nil {
+				t.Fatal(err)
+			}
+
+			// Dosages, as counts of the allele named in each column header
+			out := filepath.Join(dir, "plink2")
+			runPlink2(t, "--pfile", prefix, "--allow-extra-chr", "--export", "A", "--out", out)
+			header, rows := readPlink2Table(t, out+".raw")
+			if len(rows) != len(samples) {
+				t.Fatalf("plink2 exported %d samples, expected %d", len(rows), len(samples))
+			}
+			iid := column(t, header, "IID")
+			first := len(header) - len(want)
+			for i, row := range rows {
+				if row[iid] != samples[i].SampleID {
+					t.Fatalf("Sample %d: plink2 has %s, expected %s", i, row[iid], samples[i].SampleID)
+				}
+				for j, d := range want {
+					ref, alt := rsids[j]+"_"+string(alleles[j][0]), rsids[j]+"_"+string(alleles[j][1])
+					if name := header[first+j]; name != ref && name != alt {
+						t.Fatalf("Unexpected plink2 column %s for %s", name, rsids[j])
+					}
+					if math.IsNaN(d[i]) {
+						if row[first+j] != "NA" {
+							t.Fatalf("%s sample %d: plink2 has %s, expected NA", rsids[j], i, row[first+j])
+						}
+						continue
+					}
+					got, err := strconv.ParseFloat(row[first+j], 64)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if header[first+j] == ref {
+						// plink2 counted the REF allele
+						got = 2 - got
+					}
+					if math.Abs(got-d[i]) > 1e-3 {
+						t.Fatalf("%s sample %d: plink2 has dosage %v, expected %v", rsids[j], i, got, d[i])
+					}
+				}
+			}
+
+			// Hard calls
+			threshold := DefaultPGENHardCallThreshold
+			if test.threshold != nil {
+				threshold = *test.threshold
+			}
+			runPlink2(t, "--pfile", prefix, "--allow-extra-chr", "--geno-counts", "--out", out)
+			header, rows = readPlink2Table(t, out+".gcount")
+			if len(rows) != len(want) {
+				t.Fatalf("plink2 counted %d variants, expected %d", len(rows), len(want))
+			}
+			cols := []int{
+				column(t, header, "HOM_REF_CT"),
+				column(t, header, "HET_REF_ALT_CTS"),
+				column(t, header, "TWO_ALT_GENO_CTS"),
+				column(t, header, "MISSING_CT"),
+			}
+			for j, d := range want {
+				var counts [4]int
+				for _, dosage := range d {
+					call := 3
+					if nearest := math.Round(dosage); !math.IsNaN(dosage) && math.Abs(dosage-nearest) <= threshold {
+						call = int(nearest)
+					}
+					counts[call]++
+				}
+				for k, col := range cols {
+					if got := rows[j][col]; got != strconv.Itoa(counts[k]) {
+						t.Fatalf("%s: plink2 has %s %s, expected %d", rsids[j], header[col], got, counts[k])
+					}
+				}
+			}
+		})
+	}
+}
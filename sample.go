@@ -1,8 +1,12 @@
 package bgen
 
 import (
+	"bufio"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/carbocation/pfx"
 )
@@ -12,6 +16,12 @@ type Sample struct {
 }
 
 func ReadSamples(b *BGEN) ([]Sample, error) {
+	return ReadSamplesContext(b.context(), b)
+}
+
+// ReadSamplesContext is like ReadSamples, but stops with ctx's error if ctx
+// is done before every sample has been read.
+func ReadSamplesContext(ctx context.Context, b *BGEN) ([]Sample, error) {
 	if b.File == nil {
 		return nil, pfx.Err(fmt.Errorf("b.File is nil"))
 	}
@@ -29,7 +39,7 @@ func ReadSamples(b *BGEN) ([]Sample, error) {
 	nSamples := int(b.NSamples)
 	var sampleTextSize uint16
 	for i := 0; i < nSamples; i++ {
-		if err := b.parseAtOffsetWithBuffer(offset, bufferLength); err != nil {
+		if _, err := readAtContext(ctx, b.File, bufferLength, offset); err != nil {
 			return nil, pfx.Err(err)
 		}
 		offset += 2
@@ -41,7 +51,7 @@ func ReadSamples(b *BGEN) ([]Sample, error) {
 			bufferID = make([]byte, sampleTextSize)
 		}
 		bufferID = bufferID[:sampleTextSize]
-		if err := b.parseAtOffsetWithBuffer(offset, bufferID); err != nil {
+		if _, err := readAtContext(ctx, b.File, bufferID, offset); err != nil {
 			return nil, pfx.Err(err)
 		}
 
@@ -52,3 +62,39 @@ func ReadSamples(b *BGEN) ([]Sample, error) {
 
 	return samples, nil
 }
+
+// WriteSampleFile writes sample IDs in the Oxford .sample format, using each
+// ID as both ID_1 and ID_2 and marking nothing as missing.
+func WriteSampleFile(w io.Writer, samples []Sample) error {
+	if _, err := io.WriteString(w, "ID_1 ID_2 missing\n0 0 0\n"); err != nil {
+		return pfx.Err(err)
+	}
+	for _, s := range samples {
+		if _, err := fmt.Fprintf(w, "%s %s 0\n", s.SampleID, s.SampleID); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	return nil
+}
+
+// ReadSampleFile reads sample IDs from an Oxford .sample file, taking each
+// sample's ID_1 as its ID. The two header lines are skipped.
+func ReadSampleFile(r io.Reader) ([]Sample, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	var samples []Sample
+	for line := 0; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if line < 2 || len(fields) == 0 {
+			continue
+		}
+		samples = append(samples, Sample{SampleID: fields[0]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return samples, nil
+}
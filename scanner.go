@@ -0,0 +1,88 @@
+package bgen
+
+import (
+	"context"
+)
+
+// Scanner reads variants one at a time, in the style of bufio.Scanner:
+//
+//	s := b.NewScanner()
+//	for s.Next() {
+//		v := s.Variant()
+//		...
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+//
+// Next returns false at the end of the file or at the first error, after
+// which the Scanner does not advance.
+type Scanner struct {
+	vr   *VariantReader
+	ctx  context.Context
+	rows []VariantIndex
+	read func() *Variant
+	v    *Variant
+	done bool
+}
+
+// NewScanner returns a Scanner over every variant in file order.
+func (b *BGEN) NewScanner() *Scanner {
+	s := &Scanner{vr: b.NewVariantReader()}
+	s.read = s.vr.Read
+	return s
+}
+
+// NewIndexedScanner returns a Scanner over the variants that rows describe,
+// in the order given, reading each with ReadIndexed.
+func (b *BGEN) NewIndexedScanner(rows []VariantIndex) *Scanner {
+	s := &Scanner{vr: b.NewVariantReader(), rows: rows}
+	s.read = func() *Variant {
+		if len(s.rows) == 0 {
+			return nil
+		}
+		v := s.vr.ReadIndexed(s.rows[0])
+		if v != nil {
+			s.rows = s.rows[1:]
+		}
+		return v
+	}
+	return s
+}
+
+// WithContext makes every later read by s observe ctx, and returns s.
+func (s *Scanner) WithContext(ctx context.Context) *Scanner {
+	s.ctx = ctx
+	return s
+}
+
+// Next reads the next variant, which is then available from Variant. It
+// returns false when there are no more variants or an error occurred.
+func (s *Scanner) Next() bool {
+	if s.done {
+		return false
+	}
+
+	s.vr.ctx = s.ctx
+	s.v = s.read()
+	s.vr.ctx = nil
+
+	if s.v == nil {
+		s.done = true
+		return false
+	}
+
+	return true
+}
+
+// Variant returns the variant read by the most recent successful call to
+// Next.
+func (s *Scanner) Variant() *Variant {
+	return s.v
+}
+
+// Err returns the first error encountered, or nil if the scan ended at the
+// end of the file.
+func (s *Scanner) Err() error {
+	return s.vr.Error()
+}
@@ -0,0 +1,87 @@
+package bgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// truncatedExample writes the example file cut off partway through a
+// variant block, and returns its path.
+func truncatedExample(t *testing.T) string {
+	t.Helper()
+
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "truncated.bgen")
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestScanner(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	s := b.NewScanner()
+	n := 0
+	for s.Next() {
+		if s.Variant() == nil {
+			t.Fatal("Next returned true with no variant")
+		}
+		n++
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 199 || s.Next() {
+		t.Errorf("Scanned %d variants, expected 199", n)
+	}
+
+	rows, err := exampleBGI(t).AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = b.NewIndexedScanner([]VariantIndex{rows[7], rows[3]})
+	var rsids []string
+	for s.Next() {
+		rsids = append(rsids, s.Variant().RSID)
+	}
+	if s.Err() != nil || len(rsids) != 2 || rsids[0] != rows[7].RSID || rsids[1] != rows[3].RSID {
+		t.Errorf("Got %v (error %v), expected %s and %s", rsids, s.Err(), rows[7].RSID, rows[3].RSID)
+	}
+}
+
+func TestScannerStopsAtFirstError(t *testing.T) {
+	b, err := Open(truncatedExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	s := b.NewScanner()
+	n := 0
+	for s.Next() {
+		n++
+	}
+	if s.Err() == nil {
+		t.Fatal("Expected an error from a truncated file")
+	}
+	if n == 0 || n >= 199 || s.vr.VariantsSeen != uint32(n) {
+		t.Errorf("Scanned %d variants and saw %d", n, s.vr.VariantsSeen)
+	}
+
+	// Once an error has occurred, the reader does not move past it
+	offset := s.vr.currentOffset
+	if s.Next() || s.vr.Read() != nil || s.vr.currentOffset != offset || s.vr.VariantsSeen != uint32(n) {
+		t.Error("Expected the reader to stop advancing after an error")
+	}
+}
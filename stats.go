@@ -0,0 +1,72 @@
+package bgen
+
+import (
+	"math"
+
+	"github.com/carbocation/pfx"
+)
+
+// VariantStats summarizes the genotype probabilities of one unphased,
+// biallelic variant.
+type VariantStats struct {
+	NMissing int
+
+	// AlleleFrequency is the frequency of the second allele among nonmissing
+	// samples, computed from expected dosages.
+	AlleleFrequency float64
+	MAF             float64
+
+	// Info is the IMPUTE-style information measure: one minus the ratio of the
+	// mean genotype variance under the probabilities to the variance expected
+	// under Hardy-Weinberg equilibrium at the estimated allele frequency. It
+	// is 1 for monomorphic variants.
+	Info float64
+}
+
+// ComputeVariantStats computes VariantStats for v, which must be unphased
+// and biallelic.
+func ComputeVariantStats(v *Variant) (VariantStats, error) {
+	var stats VariantStats
+
+	dosages, err := v.Dosages(nil)
+	if err != nil {
+		return stats, pfx.Err(err)
+	}
+
+	var sumDosage, sumVariance, sumPloidy float64
+	for i, d := range dosages {
+		if math.IsNaN(d) {
+			stats.NMissing++
+			continue
+		}
+
+		sp := v.SampleProbabilities[i]
+		ploidy := int(sp.Ploidy)
+		var secondMoment float64
+		for k := 0; k < ploidy; k++ {
+			secondMoment += float64(k*k) * sp.Probabilities[k]
+		}
+		secondMoment += float64(ploidy*ploidy) * sp.Probabilities[len(sp.Probabilities)-1]
+
+		sumDosage += d
+		sumVariance += secondMoment - d*d
+		sumPloidy += float64(ploidy)
+	}
+
+	if sumPloidy == 0 {
+		stats.AlleleFrequency, stats.MAF, stats.Info = math.NaN(), math.NaN(), math.NaN()
+		return stats, nil
+	}
+
+	theta := sumDosage / sumPloidy
+	stats.AlleleFrequency = theta
+	stats.MAF = math.Min(theta, 1-theta)
+
+	if theta <= 0 || theta >= 1 {
+		stats.Info = 1
+	} else {
+		stats.Info = 1 - sumVariance/(sumPloidy*theta*(1-theta))
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,237 @@
+package bgen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/carbocation/pfx"
+)
+
+// VariantSource yields variants one at a time until Read returns nil, after
+// which Error reports whether the input ended cleanly. It is implemented by
+// VariantReader, StreamReader and GENReader.
+type VariantSource interface {
+	Read() *Variant
+	Error() error
+}
+
+// StreamReader reads a BGEN file front to back from an io.Reader, such as
+// stdin or a decompressing stream, without ever seeking. Every layout and
+// compression is supported.
+type StreamReader struct {
+	// Header describes the file. Its File holds only the bytes before the
+	// first variant, so it can be passed to ReadSamples, but not used to read
+	// variants.
+	Header *BGEN
+
+	VariantsSeen uint32
+
+	// Lazy defers decoding genotype probabilities until
+	// Variant.Probabilities is called, as for VariantReader.
+	Lazy bool
+
+	r     *bufio.Reader
+	vr    *VariantReader
+	block []byte
+	err   error
+}
+
+// NewStreamReader reads the header and sample identifier block from r and
+// returns a StreamReader positioned at the first variant.
+func NewStreamReader(r io.Reader) (*StreamReader, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+
+	// Check the fixed fields first, so that input that is not BGEN at all is
+	// rejected before its first field is trusted as a length
+	fixed := make([]byte, offsetMagicNumber+len(MagicNumber))
+	if _, err := io.ReadFull(br, fixed); err != nil {
+		return nil, pfx.Err(err)
+	}
+	if magic := fixed[offsetMagicNumber:]; string(magic) != MagicNumber {
+		return nil, pfx.Err(fmt.Errorf("The input does not start with a BGEN header: expected the Magic Number %s at offset %d, got %v", MagicNumber, offsetMagicNumber, magic))
+	}
+
+	// The first field is the offset of the first variant, relative to the
+	// end of the field itself, so it tells us how much to read up front
+	variantsStart := int64(binary.LittleEndian.Uint32(fixed)) + 4
+	headerLength := int64(binary.LittleEndian.Uint32(fixed[offsetHeaderLength:]))
+	if variantsStart < int64(len(fixed)) || headerLength+4 > variantsStart {
+		return nil, pfx.Err(fmt.Errorf("The header places the first variant at offset %d, inside the %d-byte header", variantsStart, headerLength+4))
+	}
+
+	// Grow the prefix as bytes arrive, rather than allocating the declared
+	// size up front
+	buf := bytes.NewBuffer(fixed)
+	if _, err := io.CopyN(buf, br, variantsStart-int64(len(fixed))); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, pfx.Err(err)
+	}
+	prefix := buf.Bytes()
+
+	header, err := OpenReaderAt(bytes.NewReader(prefix), int64(len(prefix)))
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return &StreamReader{
+		Header: header,
+		r:      br,
+		vr:     header.NewVariantReader(),
+	}, nil
+}
+
+// Read returns the next variant, or nil at the end of the stream or after an
+// error, which is then available from Error.
+func (sr *StreamReader) Read() *Variant {
+	if sr.err != nil {
+		return nil
+	}
+
+	v, err := sr.read()
+	if err == io.EOF && sr.VariantsSeen < sr.Header.NVariants {
+		// A stream that stops between blocks, such as a dropped connection,
+		// is only detectable from the count in the header
+		err = fmt.Errorf("The stream ended after %d of the %d variants in the header: %w", sr.VariantsSeen, sr.Header.NVariants, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		if err != io.EOF {
+			sr.err = pfx.Err(err)
+		}
+		return nil
+	}
+	sr.VariantsSeen++
+
+	return v
+}
+
+// Error returns the error that stopped Read, if any. Reaching the end of the
+// stream is not an error, unless fewer variants were read than the header
+// declares, in which case the error wraps io.ErrUnexpectedEOF.
+func (sr *StreamReader) Error() error {
+	return sr.err
+}
+
+func (sr *StreamReader) read() (*Variant, error) {
+	block, err := sr.readBlock()
+	if err != nil {
+		return nil, err
+	}
+	sr.vr.Lazy = sr.Lazy
+
+	return sr.vr.parseVariantBlock(block)
+}
+
+// streamChunkSize is the most that StreamReader reads of a field at once.
+const streamChunkSize = 1 << 20
+
+// readBlock reads the next variant block, following its length fields in
+// the same way as VariantReader.variantBlockSize. The returned slice is
+// reused by the next call.
+func (sr *StreamReader) readBlock() ([]byte, error) {
+	block := sr.block[:0]
+	defer func() { sr.block = block[:0] }()
+
+	// Only running out of input at the very first field is a clean end; any
+	// later shortfall means that the block is truncated. Fields are read in
+	// chunks of at most streamChunkSize, so that a corrupt length costs no
+	// more memory than the input actually holds.
+	read := func(n int) ([]byte, error) {
+		start := len(block)
+		for have := start; have < start+n; have = len(block) {
+			chunk := start + n - have
+			if chunk > streamChunkSize {
+				chunk = streamChunkSize
+			}
+			if cap(block) < have+chunk {
+				grown := make([]byte, have, 2*(have+chunk))
+				copy(grown, block)
+				block = grown
+			}
+			block = block[:have+chunk]
+
+			if _, err := io.ReadFull(sr.r, block[have:]); err != nil {
+				if err == io.EOF && have > 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+		}
+		return block[start:], nil
+	}
+	read16 := func() (int, error) {
+		buf, err := read(2)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.LittleEndian.Uint16(buf)), nil
+	}
+	read32 := func() (int, error) {
+		buf, err := read(4)
+		if err != nil {
+			return 0, err
+		}
+		return int(binary.LittleEndian.Uint32(buf)), nil
+	}
+
+	layout := sr.Header.FlagLayout
+	if layout == Layout1 {
+		if _, err := read(4); err != nil {
+			return nil, err
+		}
+	}
+
+	// ID, RSID and chromosome are each prefixed by a 2-byte length
+	for i := 0; i < 3; i++ {
+		n, err := read16()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := read(n); err != nil {
+			return nil, err
+		}
+	}
+
+	// Position
+	if _, err := read(4); err != nil {
+		return nil, err
+	}
+
+	nAlleles := 2
+	if layout == Layout2 {
+		var err error
+		if nAlleles, err = read16(); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := 0; i < nAlleles; i++ {
+		n, err := read32()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := read(n); err != nil {
+			return nil, err
+		}
+	}
+
+	if layout == Layout1 && sr.Header.FlagCompression == CompressionDisabled {
+		if _, err := read(6 * int(sr.Header.NSamples)); err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := read32()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := read(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return block, nil
+}
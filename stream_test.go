@@ -0,0 +1,195 @@
+package bgen
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// compareStream checks that sr yields the same variants as reading path
+// with a VariantReader.
+func compareStream(t *testing.T, path string, sr *StreamReader) {
+	t.Helper()
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if sr.Header.NVariants != b.NVariants || sr.Header.NSamples != b.NSamples || sr.Header.FlagLayout != b.FlagLayout || sr.Header.FlagCompression != b.FlagCompression {
+		t.Fatalf("Got header %+v, expected %+v", sr.Header, b)
+	}
+
+	vr := b.NewVariantReader()
+	for {
+		want, got := vr.Read(), sr.Read()
+		if want == nil || got == nil {
+			if want != got {
+				t.Fatalf("Stream has a different number of variants: %v", sr.Error())
+			}
+			break
+		}
+		if _, err := got.Probabilities(); err != nil {
+			t.Fatal(err)
+		}
+		got.lazy = nil
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("Variant %d: got %+v, expected %+v", vr.VariantsSeen, got, want)
+		}
+	}
+	if vr.Error() != nil || sr.Error() != nil {
+		t.Fatal(vr.Error(), sr.Error())
+	}
+	if sr.VariantsSeen != b.NVariants {
+		t.Errorf("Streamed %d variants, expected %d", sr.VariantsSeen, b.NVariants)
+	}
+}
+
+func TestStreamReader(t *testing.T) {
+	paths := []string{exampleBGENPath}
+	for _, opts := range []WriterOptions{
+		{Layout: Layout1, Compression: CompressionDisabled},
+		{Layout: Layout1, Compression: CompressionZLIB},
+		{Layout: Layout2, Compression: CompressionDisabled, NProbabilityBits: 8},
+		{Layout: Layout2, Compression: CompressionZStandard},
+	} {
+		paths = append(paths, writeExampleCopy(t, opts, ""))
+	}
+
+	for i, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Hide every method other than Read
+		sr, err := NewStreamReader(struct{ io.Reader }{f})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sr.Lazy = i%2 == 1
+
+		samples, err := ReadSamples(sr.Header)
+		if err != nil || len(samples) != int(sr.Header.NSamples) || samples[0].SampleID != "sample_001" {
+			t.Errorf("%s: got samples %v (error %v)", path, samples[:1], err)
+		}
+
+		compareStream(t, path, sr)
+		f.Close()
+	}
+}
+
+func TestStreamReaderTruncated(t *testing.T) {
+	f, err := os.Open(truncatedExample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	sr, err := NewStreamReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for v := sr.Read(); v != nil; v = sr.Read() {
+		n++
+	}
+	if n == 0 || !errors.Is(sr.Error(), io.ErrUnexpectedEOF) {
+		t.Errorf("Read %d variants and then got error %v, expected io.ErrUnexpectedEOF", n, sr.Error())
+	}
+	if sr.Read() != nil {
+		t.Errorf("Expected no more variants after an error")
+	}
+}
+
+func TestStreamReaderShort(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// Cut the stream cleanly between the 10th and 11th variants
+	vr := b.NewVariantReader()
+	for i := 0; i < 10; i++ {
+		vr.ReadMetadata()
+	}
+	if vr.Error() != nil {
+		t.Fatal(vr.Error())
+	}
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr, err := NewStreamReader(bytes.NewReader(data[:vr.currentOffset]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for v := sr.Read(); v != nil; v = sr.Read() {
+		n++
+	}
+	if n != 10 || !errors.Is(sr.Error(), io.ErrUnexpectedEOF) {
+		t.Errorf("Read %d variants and then got error %v, expected 10 and io.ErrUnexpectedEOF", n, sr.Error())
+	}
+}
+
+func TestStreamReaderNotBGEN(t *testing.T) {
+	// The first four bytes would declare a 4 GiB header
+	text := "\xff\xff\xff\xffThis is plain text, not a BGEN file\n"
+	if _, err := NewStreamReader(strings.NewReader(text)); err == nil {
+		t.Errorf("Expected an error for input without the Magic Number")
+	}
+
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStreamReader(bytes.NewReader(data[:100])); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Got %v for a truncated header, expected io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestStreamReaderHugeField(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.FlagLayout != Layout2 {
+		t.Fatalf("Expected the example to use %s", Layout2)
+	}
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block with empty IDs and chromosome and one allele that claims to
+	// be nearly 4 GiB long, followed by only a few bytes
+	stream := append([]byte(nil), data[:b.VariantsStart+4]...)
+	stream = append(stream, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0xf0, 0xff, 0xff, 0xff)
+	stream = append(stream, "ACGT"...)
+
+	sr, err := NewStreamReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if v := sr.Read(); v != nil || !errors.Is(sr.Error(), io.ErrUnexpectedEOF) {
+		t.Errorf("Got %v and error %v, expected io.ErrUnexpectedEOF", v, sr.Error())
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 16<<20 {
+		t.Errorf("Allocated %d bytes for a field with 4 bytes of data", allocated)
+	}
+}
@@ -0,0 +1,200 @@
+package bgen
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/carbocation/pfx"
+)
+
+// SubsetOptions selects the samples and variants that Subset keeps.
+type SubsetOptions struct {
+	// SampleIDs lists the samples to keep. Samples are written in the order
+	// in which they appear in the input. If nil, all samples are kept.
+	SampleIDs []string
+
+	// Variants lists the index rows of the variants to keep, typically found
+	// with BGIIndex.VariantsInRegion or BGIIndex.VariantsByRSID. Variants are
+	// written in the order given. If nil, all variants are kept.
+	Variants []VariantIndex
+
+	// NProbabilityBits is used when the sample set changes and variants have
+	// to be re-encoded. If zero, each variant keeps the bit depth it has in
+	// the input.
+	NProbabilityBits uint8
+}
+
+// Subset writes a new BGEN file at outPath that contains only the selected
+// samples and variants, along with an index at outPath.bgi (or a compact
+// index at outPath.bgix in builds without SQLite) and, if the input
+// has sample IDs, an Oxford .sample file alongside it. If every sample is
+// kept, variant blocks are copied byte-for-byte. Otherwise they are decoded,
+// subset and re-encoded with the input's layout and compression. outPath may
+// be a gs:// path, in which case all three files are uploaded.
+func Subset(b *BGEN, outPath string, opts SubsetOptions) error {
+	var samples []Sample
+	if b.FlagHasSampleIDs {
+		var err error
+		if samples, err = ReadSamples(b); err != nil {
+			return pfx.Err(err)
+		}
+	}
+
+	keep, err := sampleSubsetIndices(samples, opts.SampleIDs)
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	wopts := WriterOptions{
+		Layout:      b.FlagLayout,
+		Compression: b.FlagCompression,
+	}
+	nSamples := b.NSamples
+	keptSamples := samples
+	if keep != nil {
+		wopts.NProbabilityBits = opts.NProbabilityBits
+		nSamples = uint32(len(keep))
+		keptSamples = make([]Sample, len(keep))
+		for i, idx := range keep {
+			keptSamples[i] = samples[idx]
+		}
+	}
+	wopts.SampleIDs = sampleIDStrings(keptSamples)
+
+	w, err := Create(outPath, nSamples, wopts)
+	if err != nil {
+		return pfx.Err(err)
+	}
+	w.recordIndex = true
+
+	if err := copyVariantSubset(b, w, opts.Variants, keep, opts.NProbabilityBits); err != nil {
+		w.Abort()
+		return pfx.Err(err)
+	}
+	if err := w.Close(); err != nil {
+		return pfx.Err(err)
+	}
+
+	// Index the rows recorded while writing, rather than reading the output
+	// back, which for gs:// paths would mean downloading it
+	meta, err := bgiMetadataForWriter(w, outPath)
+	if err != nil {
+		return pfx.Err(err)
+	}
+	if defaultSQLiteDriver() == "" {
+		err = writeCompactIndexPath(subsetIndexPath(outPath), meta, w.rows)
+	} else {
+		err = writeBGIPath(subsetIndexPath(outPath), meta, w.rows)
+	}
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	if len(keptSamples) == 0 {
+		return nil
+	}
+
+	return pfx.Err(writeFileWith(strings.TrimSuffix(outPath, ".bgen")+".sample", func(w io.Writer) error {
+		return WriteSampleFile(w, keptSamples)
+	}))
+}
+
+// subsetIndexPath returns the path of the index that Subset writes for
+// outPath.
+func subsetIndexPath(outPath string) string {
+	if defaultSQLiteDriver() == "" {
+		return outPath + CompactIndexExtension
+	}
+
+	return outPath + ".bgi"
+}
+
+// sampleSubsetIndices maps the requested sample IDs to their positions in
+// the file. It returns nil if every sample is kept in its original order, in
+// which case no re-encoding is needed.
+func sampleSubsetIndices(samples []Sample, ids []string) ([]int, error) {
+	if ids == nil {
+		return nil, nil
+	}
+	if samples == nil {
+		return nil, fmt.Errorf("Cannot select samples by ID from a file without sample IDs")
+	}
+
+	wanted := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	keep := make([]int, 0, len(ids))
+	for i, s := range samples {
+		if wanted[s.SampleID] {
+			keep = append(keep, i)
+			delete(wanted, s.SampleID)
+		}
+	}
+	for id := range wanted {
+		return nil, fmt.Errorf("Sample %s is not present in the file (and perhaps others)", id)
+	}
+
+	if len(keep) == len(samples) {
+		return nil, nil
+	}
+
+	return keep, nil
+}
+
+// copyVariantSubset copies the selected variants (or all variants, if rows
+// is nil) from b to w, keeping only the samples at the keep positions. A nil
+// keep copies the raw blocks. Re-encoded variants use nBits bits per
+// probability, or their bit depth in b if nBits is zero.
+func copyVariantSubset(b *BGEN, w *Writer, rows []VariantIndex, keep []int, nBits uint8) error {
+	vr := b.NewVariantReader()
+
+	copyOne := func(offset int64) (int64, error) {
+		if keep == nil {
+			block, next, err := vr.rawVariantAtOffset(offset)
+			if err != nil {
+				return next, err
+			}
+			return next, w.writeRawVariant(block)
+		}
+
+		v, next, err := vr.parseVariantAtOffset(offset)
+		if err != nil {
+			return next, err
+		}
+		subset := make([]SampleProbability, len(keep))
+		for i, idx := range keep {
+			subset[i] = v.SampleProbabilities[idx]
+		}
+		v.SampleProbabilities = subset
+
+		// Re-encoding at another depth would silently inflate or lose
+		// precision, so by default each variant keeps its own
+		if nBits == 0 && b.FlagLayout == Layout2 {
+			w.opts.NProbabilityBits = v.NProbabilityBits
+		}
+		return next, w.WriteVariant(v)
+	}
+
+	if rows != nil {
+		for _, row := range rows {
+			if _, err := copyOne(int64(row.FileStartPosition)); err != nil {
+				return pfx.Err(fmt.Errorf("Variant %s at offset %d: %w", row.RSID, row.FileStartPosition, err))
+			}
+		}
+		return nil
+	}
+
+	offset := int64(vr.currentOffset)
+	for {
+		next, err := copyOne(offset)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return pfx.Err(fmt.Errorf("Variant at offset %d: %w", offset, err))
+		}
+		offset = next
+	}
+}
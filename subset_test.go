@@ -0,0 +1,222 @@
+package bgen
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// requireSQLite skips tests of .bgi files in builds with the nosqlite tag.
+func requireSQLite(t *testing.T) {
+	t.Helper()
+
+	if defaultSQLiteDriver() == "" {
+		t.Skip("No SQLite driver is linked")
+	}
+}
+
+// exampleBGI indexes the example file into a temporary directory, as a .bgi
+// file or, in builds without SQLite, as a compact index.
+func exampleBGI(t *testing.T) *BGIIndex {
+	t.Helper()
+
+	if defaultSQLiteDriver() == "" {
+		return exampleCompactIndex(t)
+	}
+
+	path := filepath.Join(t.TempDir(), "example.bgen.bgi")
+	if err := CreateBGI(exampleBGENPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	bgi, err := OpenBGI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bgi.Close() })
+
+	return bgi
+}
+
+func TestCreateBGI(t *testing.T) {
+	requireSQLite(t)
+	bgi := exampleBGI(t)
+
+	rows, err := bgi.AllVariants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 199 {
+		t.Fatalf("Got %d rows, expected 199", len(rows))
+	}
+	if bgi.Metadata.FileSize == 0 || len(bgi.Metadata.FirstThousandBytes) != 1000 {
+		t.Errorf("Unexpected metadata %+v", bgi.Metadata)
+	}
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	vr := b.NewVariantReader()
+	for _, row := range rows[:10] {
+		v := vr.ReadAt(int64(row.FileStartPosition))
+		if vr.Error() != nil {
+			t.Fatal(vr.Error())
+		}
+		if v.RSID != row.RSID || v.Position != row.Position || v.Alleles[1] != row.Allele2 {
+			t.Errorf("Index row %+v does not match variant %s", row, v.RSID)
+		}
+		if uint(vr.currentOffset) != row.FileStartPosition+row.SizeInBytes {
+			t.Errorf("Variant %s ends at %d, but the index says %d", v.RSID, vr.currentOffset, row.FileStartPosition+row.SizeInBytes)
+		}
+	}
+
+	byRSID, err := bgi.VariantsByRSID("RSID_3", "RSID_5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byRSID) != 2 {
+		t.Errorf("Got %d rows for 2 rsIDs", len(byRSID))
+	}
+}
+
+func TestParseRegion(t *testing.T) {
+	r, err := ParseRegion("01:2000-5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != (Region{Chromosome: "01", Start: 2000, End: 5000}) {
+		t.Errorf("Got %+v", r)
+	}
+
+	for _, bad := range []string{":1-2", "1:x-2", "1:5-2"} {
+		if _, err := ParseRegion(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestSubset(t *testing.T) {
+	bgi := exampleBGI(t)
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	rows, err := bgi.VariantsInRegion(Region{Chromosome: "01", Start: 2000, End: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 7 {
+		t.Fatalf("Got %d variants in the region, expected 7", len(rows))
+	}
+
+	dir := t.TempDir()
+
+	// Variants only: blocks are copied raw
+	rawPath := filepath.Join(dir, "raw.bgen")
+	if err := Subset(b, rawPath, SubsetOptions{Variants: rows}); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := Open(rawPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	if raw.NVariants != 7 || raw.NSamples != b.NSamples || raw.FlagCompression != b.FlagCompression {
+		t.Errorf("Unexpected header %+v", raw)
+	}
+
+	// Samples and variants: blocks are re-encoded
+	keptPath := filepath.Join(dir, "kept.bgen")
+	if err := Subset(b, keptPath, SubsetOptions{Variants: rows, SampleIDs: []string{"sample_003", "sample_001"}}); err != nil {
+		t.Fatal(err)
+	}
+	kept, err := Open(keptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kept.Close()
+
+	samples, err := ReadSamples(kept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || samples[0].SampleID != "sample_001" || samples[1].SampleID != "sample_003" {
+		t.Errorf("Got samples %v", samples)
+	}
+
+	want := b.NewVariantReader().ReadAt(int64(rows[0].FileStartPosition))
+	got := kept.NewVariantReader().Read()
+	if err := sameVariant(want, got); err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.SampleProbabilities[1].Probabilities[0]-want.SampleProbabilities[2].Probabilities[0]) > 1e-4 {
+		t.Errorf("Got %v, expected %v", got.SampleProbabilities[1], want.SampleProbabilities[2])
+	}
+
+	sampleFile, err := os.ReadFile(filepath.Join(dir, "kept.sample"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(sampleFile), "sample_003 sample_003 0\n") {
+		t.Errorf("Unexpected sample file:\n%s", sampleFile)
+	}
+
+	// The index is built from the rows recorded while writing
+	keptBGI, err := OpenIndex(subsetIndexPath(keptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keptBGI.Close()
+	report, err := keptBGI.Verify(kept, VerifyOptions{Fraction: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.NVariantsRead != 7 {
+		t.Errorf("Verifying the subset's index read %d variants and found %v", report.NVariantsRead, report.Problems)
+	}
+}
+
+func TestSubsetBitDepth(t *testing.T) {
+	for _, test := range []struct {
+		inputBits, optionBits, want uint8
+	}{
+		{8, 0, 8},
+		{32, 0, 32},
+		{8, 12, 12},
+	} {
+		path := writeExampleCopy(t, WriterOptions{Layout: Layout2, Compression: CompressionZLIB, NProbabilityBits: test.inputBits}, "")
+		b, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer b.Close()
+
+		outPath := filepath.Join(t.TempDir(), "subset.bgen")
+		if err := Subset(b, outPath, SubsetOptions{SampleIDs: []string{"sample_001", "sample_003"}, NProbabilityBits: test.optionBits}); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := Open(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer out.Close()
+		vr := out.NewVariantReader()
+		for v := vr.Read(); v != nil; v = vr.Read() {
+			if v.NProbabilityBits != test.want {
+				t.Fatalf("%d-bit input subset with NProbabilityBits %d: variant %s has %d bits, expected %d", test.inputBits, test.optionBits, v.ID, v.NProbabilityBits, test.want)
+			}
+		}
+		if err := vr.Error(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
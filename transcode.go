@@ -0,0 +1,64 @@
+package bgen
+
+import (
+	"io"
+
+	"github.com/carbocation/pfx"
+)
+
+// TranscodeStats summarizes a call to Transcode.
+type TranscodeStats struct {
+	NVariants uint32
+
+	// MaxProbabilityError is the largest absolute difference between any
+	// probability in the input and its representation in the output.
+	MaxProbabilityError float64
+}
+
+// Transcode re-encodes every variant of b into a new BGEN file written to w,
+// using the layout, compression and bit depth in opts. Sample IDs and the
+// header's free data area are carried over from b, so opts.SampleIDs and
+// opts.FreeData are ignored. Probabilities are rounded with the BGEN spec's
+// algorithm, so each sample's stored probabilities still sum to exactly one.
+// If w cannot seek, such as stdout, the output is streamed with b's declared
+// variant count in its header.
+func Transcode(b *BGEN, w io.Writer, opts WriterOptions) (*TranscodeStats, error) {
+	opts.SampleIDs = nil
+	if b.FlagHasSampleIDs {
+		samples, err := ReadSamples(b)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		opts.SampleIDs = sampleIDStrings(samples)
+	}
+
+	freeData, err := readFreeData(b)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	opts.FreeData = freeData
+
+	out, err := newWriterFor(w, b.NSamples, b.NVariants, opts)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	vr := b.NewVariantReader()
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		if err := out.WriteVariant(v); err != nil {
+			return nil, pfx.Err(err)
+		}
+	}
+	if err := vr.Error(); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	if err := out.Close(); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return &TranscodeStats{
+		NVariants:           out.NVariants(),
+		MaxProbabilityError: out.MaxProbabilityError(),
+	}, nil
+}
@@ -0,0 +1,198 @@
+package bgen
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"cloud.google.com/go/storage"
+	"github.com/carbocation/pfx"
+	"google.golang.org/api/googleapi"
+)
+
+// gcsUploadChunkSize is the size of each request of a resumable upload to
+// Google Storage. Each chunk is buffered in memory until it is sent.
+var gcsUploadChunkSize = googleapi.DefaultUploadChunkSize
+
+// aborter is implemented by destinations that can abandon a partial upload,
+// so that an incomplete file is never published.
+type aborter interface {
+	Abort()
+}
+
+// Output is a file created by CreateOutput. Close publishes it, while Abort
+// abandons it; whichever is called second does nothing.
+type Output interface {
+	io.WriteSeeker
+	io.Closer
+	Abort()
+}
+
+// CreateOutput creates path for writing, truncating it if it exists. Local
+// paths are created directly. gs:// paths are staged in a local temporary
+// file, so that writers can seek back to fix up headers, and uploaded on
+// Close.
+func CreateOutput(path string) (Output, error) {
+	if pathScheme(path) != "" {
+		staged, err := newStagedUpload(path)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		return staged, nil
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return localOutput{f}, nil
+}
+
+// localOutput is a local file. Aborting it only closes it.
+type localOutput struct {
+	*os.File
+}
+
+func (f localOutput) Abort() {
+	f.File.Close()
+}
+
+// createPath creates path for writing, on the local filesystem if it has no
+// scheme. gs:// paths are written with a resumable upload, which publishes
+// the object when the returned writer is closed.
+func createPath(ctx context.Context, path string) (io.WriteCloser, error) {
+	switch scheme := pathScheme(path); scheme {
+	case "":
+		return os.Create(path)
+	case "gs":
+		return createGoogleStorage(ctx, path)
+	default:
+		return nil, fmt.Errorf("Writing to %s:// paths is not supported", scheme)
+	}
+}
+
+// checkWritablePath reports an error early for paths that createPath could
+// not create, before any work is done to produce their contents.
+func checkWritablePath(path string) error {
+	switch scheme := pathScheme(path); scheme {
+	case "", "gs":
+		return nil
+	default:
+		return fmt.Errorf("Writing to %s:// paths is not supported", scheme)
+	}
+}
+
+// gcsObjectWriter uploads one object and owns the client that uploads it.
+type gcsObjectWriter struct {
+	*storage.Writer
+	client *storage.Client
+	cancel context.CancelFunc
+}
+
+func createGoogleStorage(ctx context.Context, path string) (io.WriteCloser, error) {
+	bucketName, objectName, err := gsBucketObject(path)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cancelling the context is the only way to abandon an upload without
+	// publishing what has been written so far
+	ctx, cancel := context.WithCancel(ctx)
+	w := client.Bucket(bucketName).Object(objectName).NewWriter(ctx)
+	w.ChunkSize = gcsUploadChunkSize
+
+	return &gcsObjectWriter{Writer: w, client: client, cancel: cancel}, nil
+}
+
+func (w *gcsObjectWriter) Close() error {
+	err := w.Writer.Close()
+	w.cancel()
+	if cerr := w.client.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (w *gcsObjectWriter) Abort() {
+	w.cancel()
+	w.Writer.Close()
+	w.client.Close()
+}
+
+// uploadFrom copies r to path, abandoning the upload if the copy fails.
+func uploadFrom(ctx context.Context, r io.Reader, path string) error {
+	dst, err := createPath(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, r); err != nil {
+		closeOrAbort(dst)
+		return err
+	}
+
+	return dst.Close()
+}
+
+// closeOrAbort abandons dst if it supports that, and otherwise closes it.
+func closeOrAbort(dst io.Closer) {
+	if a, ok := dst.(aborter); ok {
+		a.Abort()
+		return
+	}
+	dst.Close()
+}
+
+// stagedUpload is a local temporary file that is uploaded to dest, and then
+// removed, when it is closed. It lets a Writer seek back to fix up the
+// header even though object storage is write-once.
+type stagedUpload struct {
+	*os.File
+	dest string
+	done bool
+}
+
+func newStagedUpload(dest string) (*stagedUpload, error) {
+	if err := checkWritablePath(dest); err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "bgen-upload-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &stagedUpload{File: f, dest: dest}, nil
+}
+
+func (s *stagedUpload) Close() error {
+	if s.done {
+		return nil
+	}
+	s.done = true
+	defer os.Remove(s.Name())
+	defer s.File.Close()
+
+	if _, err := s.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return pfx.Err(uploadFrom(context.Background(), s.File, s.dest))
+}
+
+func (s *stagedUpload) Abort() {
+	if s.done {
+		return
+	}
+	s.done = true
+	s.File.Close()
+	os.Remove(s.Name())
+}
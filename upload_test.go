@@ -0,0 +1,478 @@
+package bgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeGCS implements just enough of the Google Cloud Storage JSON and XML
+// APIs for the storage client to upload objects (with multipart or
+// resumable uploads), read their attributes and read byte ranges. Setting
+// STORAGE_EMULATOR_HOST points the client at it.
+type fakeGCS struct {
+	server *httptest.Server
+
+	mu            sync.Mutex
+	objects       map[string][]byte
+	uploads       map[string]*fakeUpload
+	chunkRequests int
+}
+
+type fakeUpload struct {
+	key  string
+	data []byte
+}
+
+func newFakeGCS(t *testing.T) *fakeGCS {
+	f := &fakeGCS{objects: map[string][]byte{}, uploads: map[string]*fakeUpload{}}
+	f.server = httptest.NewServer(f)
+	t.Cleanup(f.server.Close)
+	t.Setenv("STORAGE_EMULATOR_HOST", f.server.URL)
+
+	return f
+}
+
+func (f *fakeGCS) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	data, exists := f.objects[key]
+	return data, exists
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch path := r.URL.Path; {
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/upload/storage/v1/b/"):
+		bucket := strings.TrimSuffix(strings.TrimPrefix(path, "/upload/storage/v1/b/"), "/o")
+		if id := r.URL.Query().Get("upload_id"); id != "" {
+			f.uploadChunk(w, r, id)
+			return
+		}
+		switch r.URL.Query().Get("uploadType") {
+		case "multipart":
+			f.uploadMultipart(w, r, bucket)
+		case "resumable":
+			f.startResumable(w, r, bucket)
+		default:
+			http.Error(w, "Unsupported upload type", http.StatusBadRequest)
+		}
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/storage/v1/b/"):
+		key := strings.Replace(strings.TrimPrefix(path, "/storage/v1/b/"), "/o/", "/", 1)
+		f.writeAttrs(w, key)
+	case r.Method == http.MethodGet:
+		data, exists := f.objects[strings.TrimPrefix(path, "/")]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(string(data)))
+	default:
+		http.Error(w, "Unsupported request", http.StatusBadRequest)
+	}
+}
+
+func (f *fakeGCS) writeAttrs(w http.ResponseWriter, key string) {
+	data, exists := f.objects[key]
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error": {"code": 404, "message": "Not Found"}}`)
+		return
+	}
+
+	bucket, name, _ := strings.Cut(key, "/")
+	json.NewEncoder(w).Encode(map[string]string{
+		"bucket":     bucket,
+		"name":       name,
+		"size":       strconv.Itoa(len(data)),
+		"generation": "1",
+		"updated":    "2026-01-02T03:04:05Z",
+	})
+}
+
+func (f *fakeGCS) uploadMultipart(w http.ResponseWriter, r *http.Request, bucket string) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	var meta struct{ Name string }
+	part, err := mr.NextPart()
+	if err == nil {
+		err = json.NewDecoder(part).Decode(&meta)
+	}
+	var data []byte
+	if err == nil {
+		if part, err = mr.NextPart(); err == nil {
+			data, err = io.ReadAll(part)
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.objects[bucket+"/"+meta.Name] = data
+	f.writeAttrs(w, bucket+"/"+meta.Name)
+}
+
+func (f *fakeGCS) startResumable(w http.ResponseWriter, r *http.Request, bucket string) {
+	var meta struct{ Name string }
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id := strconv.Itoa(len(f.uploads) + 1)
+	f.uploads[id] = &fakeUpload{key: bucket + "/" + meta.Name}
+	w.Header().Set("Location", fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&upload_id=%s", f.server.URL, bucket, id))
+}
+
+func (f *fakeGCS) uploadChunk(w http.ResponseWriter, r *http.Request, id string) {
+	upload, exists := f.uploads[id]
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+	f.chunkRequests++
+
+	// Content-Range is "bytes first-last/total", with a total of * until the
+	// final chunk, or "bytes */total" for an empty final chunk
+	span, total, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes "), "/")
+	if first, _, found := strings.Cut(span, "-"); found && first != strconv.Itoa(len(upload.data)) {
+		http.Error(w, "Chunk does not start where the last one ended", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	upload.data = append(upload.data, data...)
+
+	if total != "*" && total == strconv.Itoa(len(upload.data)) {
+		f.objects[upload.key] = upload.data
+		delete(f.uploads, id)
+		f.writeAttrs(w, upload.key)
+		return
+	}
+
+	// The client asks for 200 with this header instead of a 308
+	w.Header().Set("X-Http-Status-Code-Override", "308")
+	w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(upload.data)-1))
+}
+
+// withSmallUploadChunks makes uploads of the example file take several
+// resumable upload requests.
+func withSmallUploadChunks(t *testing.T) {
+	old := gcsUploadChunkSize
+	gcsUploadChunkSize = 256 << 10
+	t.Cleanup(func() { gcsUploadChunkSize = old })
+}
+
+// copyVariants writes every variant of b to w and closes w.
+func copyVariants(b *BGEN, w *Writer) error {
+	vr := b.NewVariantReader()
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		if err := w.WriteVariant(v); err != nil {
+			return err
+		}
+	}
+	if err := vr.Error(); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func TestCreateGoogleStorage(t *testing.T) {
+	gcs := newFakeGCS(t)
+	withSmallUploadChunks(t)
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	samples, err := ReadSamples(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := WriterOptions{Layout: Layout2, Compression: CompressionZLIB, SampleIDs: sampleIDStrings(samples)}
+
+	localPath := filepath.Join(t.TempDir(), "local.bgen")
+	w, err := Create(localPath, b.NSamples, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyVariants(b, w); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(localPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Staged: the header is fixed up locally, then uploaded
+	w, err = Create("gs://bucket/staged.bgen", b.NSamples, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyVariants(b, w); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gcs.object("bucket/staged.bgen"); string(got) != string(want) {
+		t.Errorf("Staged upload has %d bytes that differ from the %d written locally", len(got), len(want))
+	}
+	if gcs.chunkRequests < 2 {
+		t.Errorf("Expected a resumable upload in several requests, got %d", gcs.chunkRequests)
+	}
+
+	// Streamed with a declared count
+	w, err = CreateStream("gs://bucket/streamed.bgen", b.NSamples, b.NVariants, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyVariants(b, w); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gcs.object("bucket/streamed.bgen"); string(got) != string(want) {
+		t.Errorf("Streamed upload has %d bytes that differ from the %d written locally", len(got), len(want))
+	}
+
+	remote, err := Open("gs://bucket/streamed.bgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	compareProbabilities(t, b, remote, 1/65535.0)
+
+	// An overstated count abandons the upload instead of publishing it
+	w, err = CreateStream("gs://bucket/short.bgen", b.NSamples, b.NVariants+1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := copyVariants(b, w); err == nil {
+		t.Errorf("Expected an error for a stream with fewer variants than declared")
+	}
+	if _, exists := gcs.object("bucket/short.bgen"); exists {
+		t.Errorf("An incomplete stream was published")
+	}
+
+	// Abort abandons a staged upload, and a later Close does nothing
+	w, err = Create("gs://bucket/aborted.bgen", b.NSamples, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged := w.closer.(*stagedUpload).Name()
+	w.Abort()
+	if err := w.Close(); err != nil {
+		t.Errorf("Close after Abort: %v", err)
+	}
+	if _, exists := gcs.object("bucket/aborted.bgen"); exists {
+		t.Errorf("An aborted file was published")
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("The staged file %s was not removed: %v", staged, err)
+	}
+
+	if _, err := Create("s3://bucket/out.bgen", b.NSamples, opts); err == nil {
+		t.Errorf("Expected an error for an unsupported scheme")
+	}
+}
+
+func TestSubsetGoogleStorage(t *testing.T) {
+	gcs := newFakeGCS(t)
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	dir := t.TempDir()
+	opts := SubsetOptions{SampleIDs: []string{"sample_001", "sample_003"}}
+	if err := Subset(b, filepath.Join(dir, "kept.bgen"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := Subset(b, "gs://bucket/kept.bgen", opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index rows and sample file match those of a local subset
+	for _, name := range []string{"kept.bgen", "kept.sample"} {
+		want, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := gcs.object("bucket/" + name); string(got) != string(want) {
+			t.Errorf("Uploaded %s differs from the local subset", name)
+		}
+	}
+
+	indexPath := subsetIndexPath("kept.bgen")
+	data, exists := gcs.object("bucket/" + indexPath)
+	if !exists {
+		t.Fatal("The index was not uploaded")
+	}
+	path := filepath.Join(dir, "remote-"+indexPath)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	remote, err := OpenIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	local, err := OpenIndex(filepath.Join(dir, indexPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	compareIndexes(t, local, remote)
+}
+
+// failingSource yields the variants of vr until n have been read, and then
+// fails.
+type failingSource struct {
+	vr  *VariantReader
+	n   int
+	err error
+}
+
+func (s *failingSource) Read() *Variant {
+	if s.n == 0 {
+		s.err = fmt.Errorf("Failing as requested")
+		return nil
+	}
+	s.n--
+	return s.vr.Read()
+}
+
+func (s *failingSource) Error() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.vr.Error()
+}
+
+func TestExportPGENGoogleStorage(t *testing.T) {
+	gcs := newFakeGCS(t)
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	samples, err := ReadSamples(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if _, err := ExportPGEN(b.NewVariantReader(), b.NSamples, samples, filepath.Join(dir, "example"), PGENOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExportPGEN(b.NewVariantReader(), b.NSamples, samples, "gs://bucket/example", PGENOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{".pgen", ".pvar", ".psam"} {
+		want, err := os.ReadFile(filepath.Join(dir, "example"+suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := gcs.object("bucket/example" + suffix); string(got) != string(want) {
+			t.Errorf("Uploaded %s differs from the local export", suffix)
+		}
+	}
+
+	// A failure partway through publishes none of the files
+	src := &failingSource{vr: b.NewVariantReader(), n: 10}
+	if _, err := ExportPGEN(src, b.NSamples, samples, "gs://bucket/failed", PGENOptions{}); err == nil {
+		t.Fatal("Expected an error from the failing source")
+	}
+	for _, suffix := range []string{".pgen", ".pvar", ".psam"} {
+		if _, exists := gcs.object("bucket/failed" + suffix); exists {
+			t.Errorf("Uploaded failed%s after an error", suffix)
+		}
+	}
+}
+
+func TestCreateBGIGoogleStorage(t *testing.T) {
+	requireSQLite(t)
+	gcs := newFakeGCS(t)
+
+	if err := CreateBGI(exampleBGENPath, "gs://bucket/example.bgen.bgi"); err != nil {
+		t.Fatal(err)
+	}
+	data, exists := gcs.object("bucket/example.bgen.bgi")
+	if !exists {
+		t.Fatal("The index was not uploaded")
+	}
+
+	path := filepath.Join(t.TempDir(), "example.bgen.bgi")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	bgi, err := OpenBGI(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bgi.Close()
+
+	rows, err := bgi.VariantsInRegion(Region{Chromosome: "01", Start: 2000, End: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 7 {
+		t.Errorf("Got %d variants in the region, expected 7", len(rows))
+	}
+}
+
+func TestPCAWriteFilesGoogleStorage(t *testing.T) {
+	gcs := newFakeGCS(t)
+
+	res := &PCAResult{Eigenvalues: []float64{2, 0.5}, Eigenvectors: [][]float64{{0.6, -0.8}, {0.8, 0.6}}}
+	samples := []Sample{{"a"}, {"b"}}
+	if err := res.WriteFiles("gs://bucket/pca", samples); err != nil {
+		t.Fatal(err)
+	}
+
+	var eigenvec, eigenval strings.Builder
+	if err := res.WriteEigenvec(&eigenvec, samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := res.WriteEigenval(&eigenval); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gcs.object("bucket/pca.eigenvec"); string(got) != eigenvec.String() {
+		t.Errorf("Got .eigenvec %q, expected %q", got, eigenvec.String())
+	}
+	if got, _ := gcs.object("bucket/pca.eigenval"); string(got) != eigenval.String() {
+		t.Errorf("Got .eigenval %q, expected %q", got, eigenval.String())
+	}
+
+	// Too few samples fails before anything is published
+	if err := res.WriteFiles("gs://bucket/short", samples[:1]); err == nil {
+		t.Error("Expected an error for too few samples")
+	}
+	if _, exists := gcs.object("bucket/short.eigenvec"); exists {
+		t.Error("Uploaded short.eigenvec after an error")
+	}
+}
@@ -31,6 +31,8 @@ func Choose(n, k int) int {
 	return ans
 }
 
+// WhichSQLiteDriver returns the name of the database/sql driver used for .bgi
+// files by default, or "" in builds with the nosqlite tag.
 func WhichSQLiteDriver() string {
-	return whichSQLiteDriver
+	return defaultSQLiteDriver()
 }
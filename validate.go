@@ -0,0 +1,338 @@
+package bgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/carbocation/pfx"
+)
+
+// ValidationProblem describes one structural problem found by Validate.
+type ValidationProblem struct {
+	Offset  int64 // Byte offset at which the problem was found
+	Variant int   // Zero-based index of the affected variant, or -1
+	Message string
+}
+
+func (p ValidationProblem) String() string {
+	if p.Variant < 0 {
+		return fmt.Sprintf("offset %d: %s", p.Offset, p.Message)
+	}
+	return fmt.Sprintf("offset %d (variant %d): %s", p.Offset, p.Variant, p.Message)
+}
+
+// ValidationReport is the result of Validate.
+type ValidationReport struct {
+	FileSize      int64
+	NVariantsRead int
+	Problems      []ValidationProblem
+}
+
+// OK reports whether no problems were found.
+func (r *ValidationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ValidationReport) add(offset int64, variant int, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, ValidationProblem{
+		Offset:  offset,
+		Variant: variant,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// layout1ProbabilityTolerance is how far a Layout1 sample's probabilities may
+// sum from one. Each probability is rounded to 1/32768, so three of them can
+// be off by at most 1.5/32768 in total.
+const layout1ProbabilityTolerance = 3.0 / 32768
+
+// Validate walks every block of b and checks it for structural consistency:
+// the header counts and offsets, the sample identifier block, each variant's
+// length prefixes, decompressed sizes, ploidy, phasing flag and probability
+// sums, and finally whether any bytes trail the last variant. Every problem
+// found is recorded in the report rather than stopping at the first; only a
+// problem that makes the remainder of the file unreadable ends the walk. The
+// returned error is reserved for I/O failures.
+func Validate(b *BGEN) (*ValidationReport, error) {
+	report := &ValidationReport{FileSize: -1}
+
+	size, err := b.fileSize()
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	report.FileSize = size
+
+	headerLength := int64(b.SamplesStart) - 4
+	if headerLength < 20 {
+		report.add(offsetHeaderLength, -1, "Header length %d is shorter than the minimum of 20", headerLength)
+	}
+
+	expectedVariantsStart := headerLength
+	if b.FlagHasSampleIDs {
+		sampleBlockLength, err := validateSampleBlock(b, size, report)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+		expectedVariantsStart += sampleBlockLength
+	}
+	if int64(b.VariantsStart) < expectedVariantsStart {
+		report.add(offsetVariant, -1, "The first variant is declared to start at %d (relative to byte 4), which overlaps the header and sample blocks that end at %d", b.VariantsStart, expectedVariantsStart)
+	}
+
+	vr := b.NewVariantReader()
+	offset := int64(vr.currentOffset)
+	for i := 0; i < int(b.NVariants); i++ {
+		if offset >= size {
+			report.add(offset, i, "The header declares %d variants, but the file ends after %d", b.NVariants, i)
+			return report, nil
+		}
+
+		// Check the size before reading, since a corrupt length prefix could
+		// otherwise trigger an enormous allocation.
+		blockSize, err := vr.variantBlockSize(offset)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || (err == nil && offset+blockSize > size) {
+			report.add(offset, i, "The variant block extends past the end of the file; the remainder of the file cannot be checked")
+			return report, nil
+		} else if err != nil {
+			return nil, pfx.Err(err)
+		}
+		block, err := vr.bytesAtOffset(int(blockSize), offset)
+		if err != nil {
+			return nil, pfx.Err(err)
+		}
+
+		validateVariantBlock(b, block, offset, i, report)
+		report.NVariantsRead++
+		offset += blockSize
+	}
+
+	if offset < size {
+		report.add(offset, -1, "%d bytes follow the last of the %d declared variants", size-offset, b.NVariants)
+	}
+
+	return report, nil
+}
+
+// validateSampleBlock checks the sample identifier block and returns its
+// declared length.
+func validateSampleBlock(b *BGEN, size int64, report *ValidationReport) (int64, error) {
+	start := int64(b.SamplesStart)
+	buf := make([]byte, 8)
+	if start+8 > size {
+		report.add(start, -1, "The sample identifier block starts past the end of the file")
+		return 0, nil
+	}
+	if err := b.parseAtOffsetWithBuffer(start, buf); err != nil {
+		return 0, pfx.Err(err)
+	}
+
+	blockLength := int64(binary.LittleEndian.Uint32(buf[0:4]))
+	nSamples := binary.LittleEndian.Uint32(buf[4:8])
+	if nSamples != b.NSamples {
+		report.add(start+4, -1, "The sample identifier block lists %d samples, but the header declares %d", nSamples, b.NSamples)
+	}
+	if start+blockLength > size {
+		report.add(start, -1, "The sample identifier block of %d bytes extends past the end of the file", blockLength)
+		return blockLength, nil
+	}
+
+	block := make([]byte, blockLength)
+	if err := b.parseAtOffsetWithBuffer(start, block); err != nil {
+		return 0, pfx.Err(err)
+	}
+
+	cursor := int64(8)
+	for i := uint32(0); i < nSamples; i++ {
+		if cursor+2 > blockLength {
+			report.add(start+cursor, -1, "The sample identifier block ends after %d of %d samples", i, nSamples)
+			return blockLength, nil
+		}
+		cursor += 2 + int64(binary.LittleEndian.Uint16(block[cursor:]))
+	}
+	if cursor != blockLength {
+		report.add(start, -1, "The sample identifiers occupy %d bytes, but the sample identifier block declares %d", cursor, blockLength)
+	}
+
+	return blockLength, nil
+}
+
+// validateVariantBlock checks one variant block held in memory.
+func validateVariantBlock(b *BGEN, block []byte, offset int64, idx int, report *ValidationReport) {
+	v, cursor, err := variantIdentifiersFromBlock(block, b.FlagLayout)
+	if err != nil {
+		report.add(offset, idx, "%s", err)
+		return
+	}
+
+	if b.FlagLayout == Layout1 && v.NSamples != b.NSamples {
+		report.add(offset, idx, "The variant declares %d samples, but the header declares %d", v.NSamples, b.NSamples)
+	}
+	if b.FlagLayout == Layout2 && v.NAlleles == 0 {
+		report.add(offset, idx, "The variant has no alleles")
+	}
+
+	genotypes := block[cursor:]
+	genotypeOffset := offset + int64(cursor)
+
+	if b.FlagLayout == Layout1 && b.FlagCompression == CompressionDisabled {
+		validateProbabilitiesLayout1(genotypes, genotypeOffset, idx, int(b.NSamples), report)
+		return
+	}
+
+	// Every other combination starts with the 4-byte length of the rest of
+	// the block, which variantBlockSize has already relied upon.
+	data := genotypes[4:]
+	expectedSize := -1
+	if b.FlagLayout == Layout2 && b.FlagCompression != CompressionDisabled {
+		if len(data) < 4 {
+			report.add(genotypeOffset, idx, "The genotype block is too short to hold its decompressed length")
+			return
+		}
+		expectedSize = int(binary.LittleEndian.Uint32(data[:4]))
+		data = data[4:]
+	}
+
+	decompressed, err := decompress(b.FlagCompression, data)
+	if err != nil {
+		report.add(genotypeOffset, idx, "Could not decompress the genotype block: %s", err)
+		return
+	}
+	if expectedSize >= 0 && len(decompressed) != expectedSize {
+		report.add(genotypeOffset, idx, "The genotype block decompressed to %d bytes, but declares %d", len(decompressed), expectedSize)
+	}
+
+	if b.FlagLayout == Layout1 {
+		validateProbabilitiesLayout1(decompressed, genotypeOffset, idx, int(b.NSamples), report)
+		return
+	}
+	validateProbabilitiesLayout2(b, v, decompressed, genotypeOffset, idx, report)
+}
+
+func validateProbabilitiesLayout1(data []byte, offset int64, idx int, nSamples int, report *ValidationReport) {
+	if len(data) != 6*nSamples {
+		report.add(offset, idx, "The genotype data holds %d bytes, expected %d for %d samples", len(data), 6*nSamples, nSamples)
+		return
+	}
+
+	var nBad, firstBad int
+	for i := 0; i < nSamples; i++ {
+		var sum float64
+		for j := 0; j < 3; j++ {
+			sum += float64(binary.LittleEndian.Uint16(data[6*i+2*j:])) / 32768.0
+		}
+		// All zeroes is how Layout1 denotes a missing sample
+		if sum != 0 && math.Abs(sum-1) > layout1ProbabilityTolerance {
+			if nBad == 0 {
+				firstBad = i
+			}
+			nBad++
+		}
+	}
+	if nBad > 0 {
+		report.add(offset, idx, "%d samples have probabilities that do not sum to one (the first is sample %d)", nBad, firstBad)
+	}
+}
+
+func validateProbabilitiesLayout2(b *BGEN, v *Variant, data []byte, offset int64, idx int, report *ValidationReport) {
+	if len(data) < 10 {
+		report.add(offset, idx, "The genotype data holds only %d bytes", len(data))
+		return
+	}
+
+	nSamples := binary.LittleEndian.Uint32(data[0:4])
+	nAlleles := binary.LittleEndian.Uint16(data[4:6])
+	minPloidy, maxPloidy := data[6], data[7]
+
+	if nSamples != b.NSamples {
+		report.add(offset, idx, "The genotype data declares %d samples, but the header declares %d", nSamples, b.NSamples)
+	}
+	if nAlleles != v.NAlleles {
+		report.add(offset, idx, "The genotype data declares %d alleles, but the variant has %d", nAlleles, v.NAlleles)
+	}
+	if minPloidy > maxPloidy || maxPloidy > 63 {
+		report.add(offset, idx, "Ploidy bounds %d-%d are not valid", minPloidy, maxPloidy)
+	}
+	if len(data) < 10+int(nSamples) {
+		report.add(offset, idx, "The genotype data holds %d bytes, which is too few for %d samples", len(data), nSamples)
+		return
+	}
+
+	ploidyBytes := data[8 : 8+nSamples]
+	var nOutOfBounds int
+	for _, p := range ploidyBytes {
+		if ploidy := p & 63; ploidy < minPloidy || ploidy > maxPloidy {
+			nOutOfBounds++
+		}
+	}
+	if nOutOfBounds > 0 {
+		report.add(offset, idx, "%d samples have a ploidy outside of the declared bounds %d-%d", nOutOfBounds, minPloidy, maxPloidy)
+	}
+
+	phased := data[8+nSamples]
+	nBits := int(data[9+nSamples])
+	if phased > 1 {
+		report.add(offset, idx, "The phased flag is %d (neither 0 nor 1)", phased)
+		return
+	}
+	if nBits < 1 || nBits > 32 {
+		report.add(offset, idx, "The number of bits per probability is %d (must be 1-32 inclusive)", nBits)
+		return
+	}
+
+	// Count how many values are stored, then check the size before reading
+	nPerSample := func(ploidy int) (nGroups, perGroup int) {
+		if phased == 1 {
+			return ploidy, int(nAlleles) - 1
+		}
+		return 1, Choose(int(nAlleles)+ploidy-1, int(nAlleles)-1) - 1
+	}
+	var nValues int
+	for _, p := range ploidyBytes {
+		nGroups, perGroup := nPerSample(int(p & 63))
+		nValues += nGroups * perGroup
+	}
+	probs := data[10+nSamples:]
+	if expected := (nValues*nBits + 7) / 8; len(probs) != expected {
+		report.add(offset, idx, "The probability data holds %d bytes, expected %d", len(probs), expected)
+		return
+	}
+
+	maxValue := uint64(1)<<uint64(nBits) - 1
+	rdr := newBitReader(probs, nBits)
+	var nOverOne, nMissingNonzero, firstOverOne, firstMissingNonzero int
+	for i, p := range ploidyBytes {
+		missing := p&(1<<7) != 0
+		nGroups, perGroup := nPerSample(int(p & 63))
+
+		var overOne, nonzero bool
+		for g := 0; g < nGroups; g++ {
+			var sum uint64
+			for k := 0; k < perGroup; k++ {
+				sum += uint64(rdr.Next())
+			}
+			overOne = overOne || sum > maxValue
+			nonzero = nonzero || sum > 0
+		}
+
+		if missing && nonzero {
+			if nMissingNonzero == 0 {
+				firstMissingNonzero = i
+			}
+			nMissingNonzero++
+		} else if !missing && overOne {
+			if nOverOne == 0 {
+				firstOverOne = i
+			}
+			nOverOne++
+		}
+	}
+	if nOverOne > 0 {
+		report.add(offset, idx, "%d samples have probabilities that sum to more than one (the first is sample %d)", nOverOne, firstOverOne)
+	}
+	if nMissingNonzero > 0 {
+		report.add(offset, idx, "%d missing samples have nonzero probabilities (the first is sample %d)", nMissingNonzero, firstMissingNonzero)
+	}
+}
@@ -0,0 +1,98 @@
+package bgen
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// validateBytes writes data to a temporary file and validates it.
+func validateBytes(t *testing.T, data []byte) *ValidationReport {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.bgen")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	report, err := Validate(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return report
+}
+
+func expectProblem(t *testing.T, report *ValidationReport, substring string) {
+	t.Helper()
+
+	for _, p := range report.Problems {
+		if strings.Contains(p.Message, substring) {
+			return
+		}
+	}
+	t.Errorf("Expected a problem mentioning %q, got %v", substring, report.Problems)
+}
+
+func TestValidate(t *testing.T) {
+	original, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := validateBytes(t, original)
+	if !report.OK() {
+		t.Fatalf("Expected the example file to be valid, got %v", report.Problems)
+	}
+	if report.NVariantsRead != 199 {
+		t.Errorf("Read %d variants, expected 199", report.NVariantsRead)
+	}
+
+	// Trailing bytes
+	report = validateBytes(t, append(append([]byte{}, original...), 1, 2, 3))
+	expectProblem(t, report, "3 bytes follow the last")
+
+	// Truncation
+	report = validateBytes(t, original[:len(original)-100])
+	expectProblem(t, report, "extends past the end of the file")
+
+	// Too many declared variants
+	data := append([]byte{}, original...)
+	binary.LittleEndian.PutUint32(data[offsetNumberVariants:], 200)
+	report = validateBytes(t, data)
+	expectProblem(t, report, "declares 200 variants")
+
+	// A wrong decompressed length on the first variant, plus a wrong sample
+	// count in the sample block: both should be reported.
+	data = append([]byte{}, original...)
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	first := int64(b.VariantsStart) + 4
+	block, _, err := b.NewVariantReader().rawVariantAtOffset(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, cursor, err := variantIdentifiersFromBlock(block, b.FlagLayout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[first+int64(cursor)+4:], 12345)
+	binary.LittleEndian.PutUint32(data[b.SamplesStart+4:], 499)
+	report = validateBytes(t, data)
+	expectProblem(t, report, "but declares 12345")
+	expectProblem(t, report, "lists 499 samples")
+	if report.Problems[len(report.Problems)-1].Variant != 0 {
+		t.Errorf("Expected the last problem to concern variant 0, got %v", report.Problems)
+	}
+}
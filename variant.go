@@ -16,4 +16,8 @@ type Variant struct {
 	Phased              bool
 	NProbabilityBits    uint8
 	SampleProbabilities []SampleProbability
+
+	// lazy holds the undecoded genotype data of a Variant read by a Lazy
+	// VariantReader, until it is decoded or released.
+	lazy *lazyGenotypes
 }
@@ -1,16 +1,60 @@
 package bgen
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/carbocation/pfx"
 	"github.com/jmoiron/sqlx"
 )
 
+// errNoSQLite is returned for .bgi files by builds with the nosqlite tag,
+// which can only use compact indexes.
+var errNoSQLite = fmt.Errorf("This program was built without SQLite, so it cannot read or write .bgi files; use a compact index instead")
+
+// BGIIndex is an index of the variants in a BGEN file, opened either from a
+// bgenix-style .bgi file, whose SQLite database is DB, or from a compact
+// index, in which case DB is nil.
 type BGIIndex struct {
 	DB       *sqlx.DB
 	Metadata *BGIMetadata
+
+	// compact holds the rows of a compact index.
+	compact *compactIndex
+
+	// cleanup removes the local copy of a remote index, if one was made.
+	cleanup func()
 }
 
 func (b *BGIIndex) Close() error {
-	return b.DB.Close()
+	var err error
+	if b.DB != nil {
+		err = b.DB.Close()
+	}
+	if b.cleanup != nil {
+		b.cleanup()
+	}
+	return err
+}
+
+// localIndexPath returns a path that SQLite can open for the index at path.
+// Indexes with a URL scheme, such as gs:// or https://, are downloaded to a
+// temporary file, and the returned cleanup function removes it.
+func localIndexPath(path string) (string, func(), error) {
+	if scheme := pathScheme(path); scheme == "" || scheme == "file" {
+		return path, nil, nil
+	}
+
+	local, err := fetchToTempFile(context.Background(), path, "bgen-*.bgi")
+	if err != nil {
+		return "", nil, pfx.Err(err)
+	}
+
+	return local, func() { os.Remove(local) }, nil
 }
 
 // VariantIndex conforms to the data found in the rows of the SQLite table
@@ -35,3 +79,96 @@ type BGIMetadata struct {
 	FirstThousandBytes []byte `db:"first_1000_bytes"`
 	IndexCreationTime  Time   `db:"index_creation_time"`
 }
+
+// Region is a genomic interval. Start and End are both inclusive.
+type Region struct {
+	Chromosome string
+	Start      uint32
+	End        uint32
+}
+
+// ParseRegion parses regions of the form "chr:start-end", "chr:position" or
+// "chr". A bare chromosome covers every position on it.
+func ParseRegion(s string) (Region, error) {
+	chrom, span, hasSpan := strings.Cut(s, ":")
+	if chrom == "" {
+		return Region{}, pfx.Err(fmt.Errorf("Region %q has no chromosome", s))
+	}
+	if !hasSpan {
+		return Region{Chromosome: chrom, Start: 0, End: math.MaxUint32}, nil
+	}
+
+	startText, endText, hasEnd := strings.Cut(span, "-")
+	start, err := strconv.ParseUint(startText, 10, 32)
+	if err != nil {
+		return Region{}, pfx.Err(fmt.Errorf("Region %q has an invalid start: %w", s, err))
+	}
+	end := start
+	if hasEnd {
+		if end, err = strconv.ParseUint(endText, 10, 32); err != nil {
+			return Region{}, pfx.Err(fmt.Errorf("Region %q has an invalid end: %w", s, err))
+		}
+	}
+	if end < start {
+		return Region{}, pfx.Err(fmt.Errorf("Region %q ends before it starts", s))
+	}
+
+	return Region{Chromosome: chrom, Start: uint32(start), End: uint32(end)}, nil
+}
+
+func (r Region) String() string {
+	return fmt.Sprintf("%s:%d-%d", r.Chromosome, r.Start, r.End)
+}
+
+// VariantsInRegion returns the index rows of every variant in the region,
+// ordered by position and then by file offset.
+func (b *BGIIndex) VariantsInRegion(r Region) ([]VariantIndex, error) {
+	if b.compact != nil {
+		return b.compact.variantsInRegion(r), nil
+	}
+
+	var rows []VariantIndex
+	err := b.DB.Select(&rows, "SELECT * FROM Variant WHERE chromosome = ? AND position BETWEEN ? AND ? ORDER BY position ASC, file_start_position ASC", r.Chromosome, r.Start, r.End)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return rows, nil
+}
+
+// VariantsByRSID returns the index rows of every variant whose rsID is one of
+// rsids, in file order.
+func (b *BGIIndex) VariantsByRSID(rsids ...string) ([]VariantIndex, error) {
+	if len(rsids) == 0 {
+		return nil, nil
+	}
+	if b.compact != nil {
+		return b.compact.variantsByRSID(rsids), nil
+	}
+
+	query, args, err := sqlx.In("SELECT * FROM Variant WHERE rsid IN (?) ORDER BY file_start_position ASC", rsids)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	var rows []VariantIndex
+	if err := b.DB.Select(&rows, b.DB.Rebind(query), args...); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return rows, nil
+}
+
+// AllVariants returns every index row, in file order.
+func (b *BGIIndex) AllVariants() ([]VariantIndex, error) {
+	if b.compact != nil {
+		return b.compact.allVariants(), nil
+	}
+
+	var rows []VariantIndex
+	if err := b.DB.Select(&rows, "SELECT * FROM Variant ORDER BY file_start_position ASC"); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return rows, nil
+}
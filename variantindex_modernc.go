@@ -0,0 +1,15 @@
+//go:build (!cgo || sqlite_modernc) && !nosqlite
+
+package bgen
+
+// If cgo is not enabled, we link the modernc.org/sqlite non-cgo sqlite
+// driver. Builds with cgo can link it too, alongside the cgo driver, with the
+// sqlite_modernc tag, and then choose between them with BGIOptions.Driver.
+
+import (
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	linkedSQLiteDrivers = append(linkedSQLiteDrivers, "sqlite")
+}
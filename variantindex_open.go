@@ -0,0 +1,197 @@
+package bgen
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/carbocation/pfx"
+	"github.com/jmoiron/sqlx"
+)
+
+// linkedSQLiteDrivers lists the SQLite drivers compiled into this build, in
+// order of preference. It is filled in by the files that import them.
+var linkedSQLiteDrivers []string
+
+// defaultSQLiteDriver returns the preferred linked SQLite driver, or "" if
+// none is linked.
+func defaultSQLiteDriver() string {
+	for _, preferred := range []string{"sqlite3", "sqlite"} {
+		for _, linked := range linkedSQLiteDrivers {
+			if linked == preferred {
+				return linked
+			}
+		}
+	}
+
+	return ""
+}
+
+// BGIOptions controls how OpenBGIWithOptions opens a .bgi file.
+type BGIOptions struct {
+	// Driver is the name of the database/sql driver to use, such as "sqlite3"
+	// for github.com/mattn/go-sqlite3 (linked when cgo is enabled) or "sqlite"
+	// for modernc.org/sqlite (linked when cgo is disabled, or with the
+	// sqlite_modernc tag). Any other registered SQLite driver that accepts
+	// file: URIs may be named. Empty selects WhichSQLiteDriver().
+	Driver string
+
+	// ReadWrite opens the index for writing. By default it is opened
+	// read-only and immutable, so SQLite takes no locks and never looks for a
+	// journal, which also lets it open indexes on read-only storage. Immutable
+	// indexes must not be modified while they are open.
+	ReadWrite bool
+
+	// Mutable opens the index read-only but without promising that nothing
+	// else will modify it, so SQLite locks it while reading. It has no effect
+	// with ReadWrite.
+	Mutable bool
+
+	// CacheSize sets PRAGMA cache_size: a positive value is a number of
+	// pages, and a negative value is a number of KiB. Zero keeps SQLite's
+	// default.
+	CacheSize int
+
+	// MmapSize sets PRAGMA mmap_size, the number of bytes of the index that
+	// SQLite may memory-map instead of reading. Zero keeps SQLite's default,
+	// which is usually to not memory-map.
+	MmapSize int64
+}
+
+// OpenBGI opens the .bgi index at path read-only with the default SQLite
+// driver. Paths with a URL scheme are downloaded to a temporary file first,
+// which is removed on Close.
+func OpenBGI(path string) (*BGIIndex, error) {
+	return OpenBGIWithOptions(path, BGIOptions{})
+}
+
+// OpenBGIWithOptions opens the .bgi index at path as OpenBGI does, with the
+// driver, access mode and tuning in opts.
+func OpenBGIWithOptions(path string, opts BGIOptions) (*BGIIndex, error) {
+	driverName := opts.Driver
+	if driverName == "" {
+		if driverName = defaultSQLiteDriver(); driverName == "" {
+			return nil, pfx.Err(errNoSQLite)
+		}
+	}
+
+	// sql.Open only looks the driver up; it does not connect
+	probe, err := sql.Open(driverName, "")
+	if err != nil {
+		return nil, pfx.Err(fmt.Errorf("SQLite driver %q is not linked into this program; registered drivers are %v", driverName, sql.Drivers()))
+	}
+	drv := probe.Driver()
+	probe.Close()
+
+	bgi := &BGIIndex{
+		Metadata: &BGIMetadata{},
+	}
+
+	path, cleanup, err := localIndexPath(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+	bgi.cleanup = cleanup
+
+	connector := &sqliteConnector{
+		driver:  drv,
+		dsn:     sqliteFileURI(path),
+		pragmas: opts.pragmas(),
+	}
+	switch {
+	case opts.ReadWrite:
+	case opts.Mutable:
+		connector.dsn += "?mode=ro"
+	default:
+		connector.dsn += "?mode=ro&immutable=1"
+	}
+
+	db := sqlx.NewDb(sql.OpenDB(connector), driverName)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		if cleanup != nil {
+			cleanup()
+		}
+		return nil, pfx.Err(err)
+	}
+	bgi.DB = db
+
+	// Not all index files have metadata; ignore any error
+	_ = bgi.DB.Get(bgi.Metadata, "SELECT * FROM Metadata LIMIT 1")
+
+	return bgi, nil
+}
+
+func (opts BGIOptions) pragmas() []string {
+	var pragmas []string
+	if opts.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = %d", opts.CacheSize))
+	}
+	if opts.MmapSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA mmap_size = %d", opts.MmapSize))
+	}
+
+	return pragmas
+}
+
+// sqliteFileURI returns the file: URI for path. URI filenames have to begin
+// with 'file:'; see https://www.sqlite.org/c3ref/open.html . It seems that
+// sqlite3 permitted URI filenames without the file: prefix, but that is not
+// standard. Characters that would start a query or fragment are escaped.
+func sqliteFileURI(path string) string {
+	if strings.HasPrefix(path, "file:") {
+		return path
+	}
+
+	return "file:" + strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23").Replace(path)
+}
+
+// sqliteConnector opens connections with a fixed DSN and applies pragmas to
+// each one, since pragmas such as cache_size only affect the connection they
+// are run on and database/sql may open several.
+type sqliteConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+}
+
+func (c *sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pragma := range c.pragmas {
+		if err := execConn(ctx, conn, pragma); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Unable to run %s: %w", pragma, err)
+		}
+	}
+
+	return conn, nil
+}
+
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// execConn runs query, which takes no arguments, on a raw driver connection.
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nil)
+	return err
+}
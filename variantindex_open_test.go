@@ -0,0 +1,121 @@
+package bgen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenBGIWithOptions(t *testing.T) {
+	requireSQLite(t)
+
+	// The ? would start the query string of an unescaped URI
+	path := filepath.Join(t.TempDir(), "ex?ample.bgen.bgi")
+	if err := CreateBGI(exampleBGENPath, path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, driver := range linkedSQLiteDrivers {
+		t.Run(driver, func(t *testing.T) {
+			bgi, err := OpenBGIWithOptions(path, BGIOptions{Driver: driver, CacheSize: -4096, MmapSize: 1 << 20})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer bgi.Close()
+
+			rows, err := bgi.AllVariants()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 199 {
+				t.Errorf("Got %d rows, expected 199", len(rows))
+			}
+
+			var cacheSize int
+			if err := bgi.DB.Get(&cacheSize, "PRAGMA cache_size"); err != nil {
+				t.Fatal(err)
+			}
+			if cacheSize != -4096 {
+				t.Errorf("Got cache_size %d, expected -4096", cacheSize)
+			}
+
+			var mmapSize int64
+			if err := bgi.DB.Get(&mmapSize, "PRAGMA mmap_size"); err != nil {
+				t.Fatal(err)
+			}
+			if mmapSize != 1<<20 {
+				t.Errorf("Got mmap_size %d, expected %d", mmapSize, 1<<20)
+			}
+
+			if _, err := bgi.DB.Exec("DELETE FROM Variant"); err == nil {
+				t.Errorf("Expected an error writing to an index opened read-only")
+			}
+			bgi.Close()
+
+			mutable, err := OpenBGIWithOptions(path, BGIOptions{Driver: driver, Mutable: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rows, err := mutable.AllVariants(); err != nil || len(rows) != 199 {
+				t.Errorf("Got %d rows and error %v from a mutable index, expected 199", len(rows), err)
+			}
+			if _, err := mutable.DB.Exec("DELETE FROM Variant"); err == nil {
+				t.Errorf("Expected an error writing to an index opened read-only and mutable")
+			}
+			mutable.Close()
+
+			rw, err := OpenBGIWithOptions(path, BGIOptions{Driver: driver, ReadWrite: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rw.Close()
+			if _, err := rw.DB.Exec("UPDATE Variant SET rsid = rsid"); err != nil {
+				t.Errorf("Writing to an index opened with ReadWrite: %v", err)
+			}
+		})
+	}
+
+	if _, err := OpenBGIWithOptions(path, BGIOptions{Driver: "nonexistent"}); err == nil {
+		t.Errorf("Expected an error for an unregistered driver")
+	}
+}
+
+func TestOpenBGIReadOnlyStorage(t *testing.T) {
+	requireSQLite(t)
+	if os.Geteuid() == 0 {
+		t.Skip("Permissions are not enforced for root")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "example.bgen.bgi")
+	if err := CreateBGI(exampleBGENPath, path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	// Without immutable=1, SQLite would need to create a journal or lock file
+	// next to the index
+	for _, driver := range linkedSQLiteDrivers {
+		t.Run(driver, func(t *testing.T) {
+			bgi, err := OpenBGIWithOptions(path, BGIOptions{Driver: driver})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer bgi.Close()
+
+			rows, err := bgi.AllVariants()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 199 {
+				t.Errorf("Got %d rows, expected 199", len(rows))
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build cgo && !nosqlite
+
+package bgen
+
+// If cgo is enabled, we link the mattn cgo sqlite3 driver. It is faster than
+// the modernc sqlite driver, so it is the default when both are linked.
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	linkedSQLiteDrivers = append(linkedSQLiteDrivers, "sqlite3")
+}
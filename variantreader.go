@@ -3,7 +3,9 @@ package bgen
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -16,8 +18,20 @@ type VariantReader struct {
 	currentOffset uint32
 	err           error
 
+	// ctx, if set, overrides the BGEN's context for the current read
+	ctx context.Context
+
+	// Lazy defers decoding genotype probabilities until
+	// Variant.Probabilities is called. Until then, a Variant holds its
+	// undecoded genotype data in a pooled buffer, and only the fields set by
+	// ReadMetadata are populated.
+	Lazy bool
+
 	// Cached values
-	buffer []byte
+	buffer        []byte
+	lastBlockSize int64
+	fileSize      int64
+	fileSizeKnown bool
 }
 
 func (b *BGEN) NewVariantReader() *VariantReader {
@@ -38,31 +52,54 @@ func (vr *VariantReader) Error() error {
 // Read extracts the next variant and its genotype probabilities from the
 // bitstream. If there are no variants left to read, Read returns nil. If there
 // is a true error, Read populates the error value on the VariantReader, which
-// can be read by calling the Error() method on the VariantReader.
+// can be read by calling the Error() method on the VariantReader. After an
+// error, the VariantReader no longer advances and every read returns nil.
+// Scanner offers a harder-to-misuse interface to the same reads.
 func (vr *VariantReader) Read() *Variant {
-	v, newOffset, err := vr.parseVariantAtOffset(int64(vr.currentOffset))
-	if err != nil {
-		if err == io.EOF {
-			return nil
-		}
-		vr.err = pfx.Err(err)
+	if vr.err != nil {
+		return nil
 	}
 
-	vr.VariantsSeen++
-	vr.currentOffset = uint32(newOffset)
-
-	return v
+	v, newOffset, err := vr.parseVariantAtOffset(int64(vr.currentOffset))
+	return vr.advance(v, newOffset, pfx.Err(err))
 }
 
 // ReadAt extracts the variant and its genotype probabilities from the bitstream
 // at the specified offset. Otherwise, it behaves like Read().
 func (vr *VariantReader) ReadAt(byteOffset int64) *Variant {
+	if vr.err != nil {
+		return nil
+	}
+
 	v, newOffset, err := vr.parseVariantAtOffset(byteOffset)
+	return vr.advance(v, newOffset, pfx.Err(err))
+}
+
+// ReadMetadata extracts the identifying fields of the next variant (its IDs,
+// position and alleles) without decoding its genotype probabilities, which
+// is much faster when only the metadata is needed. SampleProbabilities is
+// left empty. Otherwise, it behaves like Read().
+func (vr *VariantReader) ReadMetadata() *Variant {
+	if vr.err != nil {
+		return nil
+	}
+
+	block, newOffset, err := vr.rawVariantAtOffset(int64(vr.currentOffset))
+	var v *Variant
+	if err == nil {
+		v, _, err = variantIdentifiersFromBlock(block, vr.b.FlagLayout)
+	}
+	return vr.advance(v, newOffset, pfx.Err(err))
+}
+
+// advance records the outcome of a read. The reader only moves past a
+// variant that was read successfully; io.EOF ends the file without an error.
+func (vr *VariantReader) advance(v *Variant, newOffset int64, err error) *Variant {
 	if err != nil {
-		if err == io.EOF {
-			return nil
+		if !errors.Is(err, io.EOF) {
+			vr.err = err
 		}
-		vr.err = pfx.Err(err)
+		return nil
 	}
 
 	vr.VariantsSeen++
@@ -71,210 +108,415 @@ func (vr *VariantReader) ReadAt(byteOffset int64) *Variant {
 	return v
 }
 
-// parseVariantAtOffset makes heavy use of readNBytesAtOffset to read one
-// variant starting at the given offset. readNBytesAtOffset does mutate
-// *VariantReader by modifying its buffer to reduce allocations.
+// parseVariantAtOffset reads one variant starting at the given offset. It
+// walks the length fields to find the size of the block, reads the whole
+// block at once, and decodes it from memory. It mutates *VariantReader by
+// reusing its buffer to reduce allocations.
 func (vr *VariantReader) parseVariantAtOffset(offset int64) (*Variant, int64, error) {
-	v := &Variant{}
+	block, next, err := vr.rawVariantAtOffset(offset)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	v, err := vr.parseVariantBlock(block)
+	if err != nil {
+		return nil, offset, err
+	}
+
+	return v, next, nil
+}
+
+// parseVariantBlock decodes a complete in-memory variant block. Unless the
+// reader is Lazy, this includes its genotype probabilities. The block must
+// contain exactly one variant. The returned Variant does not alias block.
+func (vr *VariantReader) parseVariantBlock(block []byte) (*Variant, error) {
+	v, cursor, err := variantIdentifiersFromBlock(block, vr.b.FlagLayout)
+	if err != nil {
+		return nil, err
+	}
+
+	if vr.Lazy {
+		v.lazy = newLazyGenotypes(vr.b, block[cursor:])
+		return v, nil
+	}
+
+	if err := vr.decodeGenotypes(v, block[cursor:]); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// decodeGenotypes decodes the genotype section of a variant block, which
+// follows its identifying fields, into v.
+func (vr *VariantReader) decodeGenotypes(v *Variant, block []byte) error {
 	var err error
+	cursor := 0
 
-VariantLoop:
-	for {
-		if vr.b.FlagLayout == Layout1 {
-			// Layout1 has 4 extra bytes at the start of each variant that
-			// denotes the number of individuals the row represents. In Layout2,
-			// this is denoted within the genotype probability block.
-			if err = vr.readNBytesAtOffset(4, offset); err != nil {
-				break
-			}
-			offset += 4
-			v.NSamples = binary.LittleEndian.Uint32(vr.buffer[:4])
+	next := func(n int) ([]byte, error) {
+		if n < 0 || cursor+n > len(block) {
+			return nil, fmt.Errorf("Genotype block of %d bytes is too short to read %d bytes at position %d", len(block), n, cursor)
+		}
+		out := block[cursor : cursor+n]
+		cursor += n
+		return out, nil
+	}
+	nextUint32 := func() (uint32, error) {
+		buf, err := next(4)
+		if err != nil {
+			return 0, err
 		}
+		return binary.LittleEndian.Uint32(buf), nil
+	}
 
-		// ID:
-		if err = vr.readNBytesAtOffset(2, offset); err != nil {
-			break
+	// Genotype data
+	if vr.b.FlagLayout == Layout1 {
+		var data []byte
+		switch vr.b.FlagCompression {
+		case CompressionDisabled:
+			// From the spec: "If CompressedSNPBlocks=0 this field is omitted
+			// and the length of the uncompressed data is C=6N."
+			data, err = next(int(6 * vr.b.NSamples))
+		case CompressionZLIB:
+			var genoBlockLength uint32
+			if genoBlockLength, err = nextUint32(); err == nil {
+				data, err = next(int(genoBlockLength))
+			}
+		default:
+			err = fmt.Errorf("Compression choice %s is not compatible with Layout %s", vr.b.FlagCompression, vr.b.FlagLayout)
 		}
-		offset += 2
-		stringSize := int(binary.LittleEndian.Uint16(vr.buffer[:2]))
-		if err = vr.readNBytesAtOffset(stringSize, offset); err != nil {
-			break
+		if err != nil {
+			return err
 		}
-		v.ID = string(vr.buffer[:stringSize])
-		offset += int64(stringSize)
 
-		// RSID
-		if err = vr.readNBytesAtOffset(2, offset); err != nil {
-			break
+		if err := vr.populateProbabilitiesLayout1(v, data, len(data)); err != nil {
+			return err
 		}
-		offset += 2
-		stringSize = int(binary.LittleEndian.Uint16(vr.buffer[:2]))
-		if err = vr.readNBytesAtOffset(stringSize, offset); err != nil {
-			break
+	} else if vr.b.FlagLayout == Layout2 {
+		// The genotype layout data block for Layout2 is guaranteed to have a
+		// 4 byte chunk that indicates how much data is left for this block.
+		nextDataOffset, err := nextUint32()
+		if err != nil {
+			return err
 		}
-		v.RSID = string(vr.buffer[:stringSize])
-		offset += int64(stringSize)
 
-		// Chrom
-		if err = vr.readNBytesAtOffset(2, offset); err != nil {
-			break
+		if vr.b.FlagCompression == CompressionDisabled {
+			data, err := next(int(nextDataOffset))
+			if err != nil {
+				return err
+			}
+			if err = vr.populateProbabilitiesLayout2(v, data, int(nextDataOffset)); err != nil {
+				return err
+			}
+		} else {
+			// If compression is enabled, a second 4 byte chunk gives the
+			// size of the data after decompression. From the spec: "If
+			// CompressedSNPBlocks is nonzero, this is C-4 bytes which can be
+			// uncompressed to form D bytes in the format described below."
+			// For us, "C" is nextDataOffset.
+			decompressedDataLength, err := nextUint32()
+			if err != nil {
+				return err
+			}
+			data, err := next(int(nextDataOffset) - 4)
+			if err != nil {
+				return err
+			}
+			if err = vr.populateProbabilitiesLayout2(v, data, int(decompressedDataLength)); err != nil {
+				return err
+			}
 		}
-		offset += 2
-		stringSize = int(binary.LittleEndian.Uint16(vr.buffer[:2]))
-		if stringSize != 2 {
-			// This is OK; nothing to do. Reminder to self: We read 2 bytes to
-			// discover how many characters are in the chromosome field. This
-			// does *not* mean that the chromosome field must be 2 characters
-			// long. The chr can be 1 character, 20 characters, whatever.
+	}
+
+	if cursor != len(block) {
+		return fmt.Errorf("Genotype block of %d bytes ends after %d bytes", len(block), cursor)
+	}
+
+	return nil
+}
+
+// rawVariantAtOffset returns the undecoded bytes of the variant block that
+// starts at offset, along with the offset of the next block. Only the length
+// fields are interpreted. The returned slice aliases the VariantReader's
+// buffer and is only valid until the next read.
+func (vr *VariantReader) rawVariantAtOffset(offset int64) ([]byte, int64, error) {
+	// A block can start no later than the end of the file, where there is
+	// simply nothing more to read
+	fileSize := vr.knownFileSize()
+	if fileSize >= 0 && offset > fileSize {
+		return nil, offset, io.ErrUnexpectedEOF
+	}
+	if fileSize >= 0 && offset == fileSize {
+		return nil, offset, io.EOF
+	}
+
+	if _, ok := vr.b.File.(byteSlicer); ok {
+		// Walking the length fields of a mapping costs no I/O
+		size, err := vr.variantBlockSize(offset)
+		if err != nil {
+			return nil, offset, err
+		}
+		block, err := vr.bytesAtOffset(int(size), offset)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
-		if err = vr.readNBytesAtOffset(stringSize, offset); err != nil {
-			break
+		if err != nil {
+			return nil, offset, err
 		}
-		v.Chromosome = string(vr.buffer[:stringSize])
-		offset += int64(stringSize)
+		return block, offset + size, nil
+	}
 
-		// Position
-		if err = vr.readNBytesAtOffset(4, offset); err != nil {
-			break
+	// Read a prefix that usually holds the whole block, since neighbouring
+	// blocks tend to be of similar size, and only read again for the rest of
+	// a larger block. Walking the length fields with a read for each would
+	// cost a round trip per field on remote files.
+	n := vr.lastBlockSize
+	if n < variantPrefixSize {
+		n = variantPrefixSize
+	}
+	for {
+		if fileSize >= 0 && offset+n > fileSize {
+			n = fileSize - offset
 		}
-		offset += 4
-		v.Position = binary.LittleEndian.Uint32(vr.buffer[:4])
-
-		// NAlleles
-		if vr.b.FlagLayout == Layout1 {
-			// Assumed to be 2 in Layout1
-			v.NAlleles = 2
-		} else if vr.b.FlagLayout == Layout2 {
-			if err = vr.readNBytesAtOffset(2, offset); err != nil {
-				break
-			}
-			offset += 2
-			v.NAlleles = binary.LittleEndian.Uint16(vr.buffer[:2])
+		prefix, err := vr.prefixAtOffset(int(n), offset)
+		if err != nil {
+			return nil, offset, err
+		}
+		if len(prefix) == 0 {
+			return nil, offset, io.EOF
 		}
 
-		// Allele slice
-		var alleleLength int
-		for i := uint16(0); i < v.NAlleles; i++ {
-			if err = vr.readNBytesAtOffset(4, offset); err != nil {
-				break VariantLoop
+		size, known := vr.variantBlockSizeFromPrefix(prefix)
+		if !known {
+			if int64(len(prefix)) < n || n == fileSize-offset {
+				// The file ends before the length fields do
+				return nil, offset, io.ErrUnexpectedEOF
 			}
-			offset += 4
-			alleleLength = int(binary.LittleEndian.Uint32(vr.buffer[:4]))
+			n *= 2
+			continue
+		}
+		if fileSize >= 0 && offset+size > fileSize {
+			return nil, offset, io.ErrUnexpectedEOF
+		}
+		vr.lastBlockSize = size
 
-			if err = vr.readNBytesAtOffset(alleleLength, offset); err != nil {
-				break VariantLoop
-			}
-			offset += int64(alleleLength)
-			v.Alleles = append(v.Alleles, Allele(string(vr.buffer[:alleleLength])))
+		block, err := vr.extendPrefix(prefix, int(size), offset)
+		if err != nil {
+			return nil, offset, err
 		}
 
-		// Genotype data
-		if vr.b.FlagLayout == Layout1 {
-			// From the spec: "If CompressedSNPBlocks=0 this field is omitted
-			// and the length of the uncompressed data is C=6N."
-			if comp := vr.b.FlagCompression; comp == CompressionDisabled {
-				uncompressedDataBlockSize := int64(6 * vr.b.NSamples)
-				if err = vr.readNBytesAtOffset(int(uncompressedDataBlockSize), offset); err != nil {
-					break
-				}
-				offset += uncompressedDataBlockSize
-				// Handle the uncompressed genotype data
-				if err = vr.populateProbabilitiesLayout1(v, vr.buffer[:uncompressedDataBlockSize], int(uncompressedDataBlockSize)); err != nil {
-					break
-				}
+		return block, offset + size, nil
+	}
+}
 
-			} else if comp == CompressionZLIB {
-				if err = vr.readNBytesAtOffset(4, offset); err != nil {
-					break
-				}
-				offset += 4
-				genoBlockLength := binary.LittleEndian.Uint32(vr.buffer[:4])
+// variantPrefixSize is the least that rawVariantAtOffset reads before it
+// knows the size of a block.
+const variantPrefixSize = 4096
 
-				if err = vr.readNBytesAtOffset(int(genoBlockLength), offset); err != nil {
-					break
-				}
-				offset += int64(genoBlockLength)
-				// Handle the ZLIB compressed genotype data
-				if err = vr.populateProbabilitiesLayout1(v, vr.buffer[:genoBlockLength], int(genoBlockLength)); err != nil {
-					break
-				}
-			} else {
-				err = fmt.Errorf("Compression choice %s is not compatible with Layout %s", vr.b.FlagCompression, vr.b.FlagLayout)
-				break
-			}
+// knownFileSize returns the size of the file, or -1 if it cannot be
+// determined. It is looked up once per VariantReader.
+func (vr *VariantReader) knownFileSize() int64 {
+	if !vr.fileSizeKnown {
+		vr.fileSizeKnown = true
+		vr.fileSize = -1
+		if size, err := vr.b.fileSize(); err == nil {
+			vr.fileSize = size
+		}
+	}
 
-		} else if vr.b.FlagLayout == Layout2 {
-			// The genotype layout data block for Layout2 is guaranteed to have
-			// a 4 byte chunk that indicates how much data is left for this
-			// block (skipping ahead by this much will bring you to the next
-			// chunk).
-			if err = vr.readNBytesAtOffset(4, offset); err != nil {
-				break
-			}
-			offset += 4
-			nextDataOffset := binary.LittleEndian.Uint32(vr.buffer[:4])
+	return vr.fileSize
+}
 
-			if vr.b.FlagCompression == CompressionDisabled {
-				// If compression is disabled, it will not have the second 4
-				// byte chunk that indicates how large the data chunk is after
-				// decompression.
+// prefixAtOffset reads up to N bytes starting at offset into the
+// VariantReader's buffer, returning fewer only at the end of the file.
+func (vr *VariantReader) prefixAtOffset(N int, offset int64) ([]byte, error) {
+	if N <= 0 {
+		return nil, nil
+	}
+	if len(vr.buffer) < N {
+		vr.buffer = make([]byte, N)
+	}
 
-				if err = vr.readNBytesAtOffset(int(nextDataOffset), offset); err != nil {
-					break
-				}
-				// Handle the uncompressed genotype data
-				if err = vr.populateProbabilitiesLayout2(v, vr.buffer[:nextDataOffset], int(nextDataOffset)); err != nil {
-					break
-				}
+	n, err := readAtContext(vr.context(), vr.b.File, vr.buffer[:N], offset)
+	if err == io.EOF {
+		err = nil
+	}
+	return vr.buffer[:n], err
+}
 
-				offset += int64(nextDataOffset)
+// extendPrefix returns the size bytes starting at offset, of which prefix,
+// which must be at the start of the VariantReader's buffer, holds the first.
+func (vr *VariantReader) extendPrefix(prefix []byte, size int, offset int64) ([]byte, error) {
+	if size <= len(prefix) {
+		return prefix[:size], nil
+	}
 
-			} else {
-				// If compression is enabled, there will be a second 4 byte
-				// chunk that indicates how large the data chunk is after
-				// decompression.
+	if len(vr.buffer) < size {
+		grown := make([]byte, size)
+		copy(grown, prefix)
+		vr.buffer = grown
+	}
 
-				if err = vr.readNBytesAtOffset(4, offset); err != nil {
-					break
-				}
-				offset += 4
-				decompressedDataLength := binary.LittleEndian.Uint32(vr.buffer[:4])
-				// TODO: Is this a checksum or actually useful?
-				_ = decompressedDataLength // ???
-
-				// From the spec: "If CompressedSNPBlocks is nonzero, this is
-				// C-4 bytes which can be uncompressed to form D bytes in the
-				// format described below." For us, "C" is nextDataOffset.
-				genoBlockDataSizeToDecompress := nextDataOffset - 4
-				// Compressed geno data
-				if err = vr.readNBytesAtOffset(int(genoBlockDataSizeToDecompress), offset); err != nil {
-					break
-				}
-				// Handle the compressed genotype data
-				if err = vr.populateProbabilitiesLayout2(v, vr.buffer[:genoBlockDataSizeToDecompress], int(decompressedDataLength)); err != nil {
-					break
-				}
+	rest := vr.buffer[len(prefix):size]
+	n, err := readAtContext(vr.context(), vr.b.File, rest, offset+int64(len(prefix)))
+	if err == io.EOF && n < len(rest) {
+		err = io.ErrUnexpectedEOF
+	} else if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
-				offset += int64(genoBlockDataSizeToDecompress)
-			}
+	return vr.buffer[:size], nil
+}
+
+// variantBlockSizeFromPrefix works out the size of the variant block that
+// starts prefix from its length fields, as variantBlockSize does from the
+// file. It reports false if prefix ends before the last length field.
+func (vr *VariantReader) variantBlockSizeFromPrefix(prefix []byte) (int64, bool) {
+	var cursor int64
+	field := func(n int64) ([]byte, bool) {
+		if cursor+n > int64(len(prefix)) {
+			return nil, false
 		}
+		return prefix[cursor : cursor+n], true
+	}
 
-		break
+	if vr.b.FlagLayout == Layout1 {
+		cursor += 4
 	}
 
-	if err != nil {
-		v = nil
+	// ID, RSID and chromosome are each prefixed by a 2-byte length
+	for i := 0; i < 3; i++ {
+		buf, ok := field(2)
+		if !ok {
+			return 0, false
+		}
+		cursor += 2 + int64(binary.LittleEndian.Uint16(buf))
+	}
+
+	// Position
+	cursor += 4
+
+	nAlleles := 2
+	if vr.b.FlagLayout == Layout2 {
+		buf, ok := field(2)
+		if !ok {
+			return 0, false
+		}
+		cursor += 2
+		nAlleles = int(binary.LittleEndian.Uint16(buf))
+	}
+
+	for i := 0; i < nAlleles; i++ {
+		buf, ok := field(4)
+		if !ok {
+			return 0, false
+		}
+		cursor += 4 + int64(binary.LittleEndian.Uint32(buf))
+	}
+
+	if vr.b.FlagLayout == Layout1 && vr.b.FlagCompression == CompressionDisabled {
+		return cursor + int64(6*vr.b.NSamples), true
+	}
+
+	buf, ok := field(4)
+	if !ok {
+		return 0, false
+	}
+
+	return cursor + 4 + int64(binary.LittleEndian.Uint32(buf)), true
+}
+
+// variantBlockSize walks the length fields of the variant block starting at
+// offset and returns the total size of the block in bytes.
+func (vr *VariantReader) variantBlockSize(offset int64) (int64, error) {
+	start := offset
+
+	if vr.b.FlagLayout == Layout1 {
+		offset += 4
+	}
+
+	// Only running out of file at the very first field is a clean end; any
+	// later shortfall means that the block is truncated.
+	firstField := offset
+	read := func(n int) ([]byte, error) {
+		buf, err := vr.bytesAtOffset(n, offset)
+		if err == io.EOF && offset != firstField {
+			err = io.ErrUnexpectedEOF
+		}
+		return buf, err
+	}
+
+	// ID, RSID and chromosome are each prefixed by a 2-byte length
+	for i := 0; i < 3; i++ {
+		buf, err := read(2)
+		if err != nil {
+			return 0, err
+		}
+		offset += 2 + int64(binary.LittleEndian.Uint16(buf))
+	}
+
+	// Position
+	offset += 4
+
+	nAlleles := 2
+	if vr.b.FlagLayout == Layout2 {
+		buf, err := read(2)
+		if err != nil {
+			return 0, err
+		}
+		offset += 2
+		nAlleles = int(binary.LittleEndian.Uint16(buf))
 	}
-	return v, offset, err
+
+	for i := 0; i < nAlleles; i++ {
+		buf, err := read(4)
+		if err != nil {
+			return 0, err
+		}
+		offset += 4 + int64(binary.LittleEndian.Uint32(buf))
+	}
+
+	if vr.b.FlagLayout == Layout1 && vr.b.FlagCompression == CompressionDisabled {
+		offset += int64(6 * vr.b.NSamples)
+	} else {
+		buf, err := read(4)
+		if err != nil {
+			return 0, err
+		}
+		offset += 4 + int64(binary.LittleEndian.Uint32(buf))
+	}
+
+	return offset - start, nil
 }
 
-func (vr *VariantReader) readNBytesAtOffset(N int, offset int64) error {
+// bytesAtOffset returns N bytes of the file starting at offset. For
+// memory-mapped files, this is a slice of the mapping; otherwise the bytes
+// are read into the VariantReader's buffer. Either way, the result is only
+// valid until the next read.
+func (vr *VariantReader) bytesAtOffset(N int, offset int64) ([]byte, error) {
+	if m, ok := vr.b.File.(byteSlicer); ok {
+		if err := vr.context().Err(); err != nil {
+			return nil, err
+		}
+		return m.slice(offset, N)
+	}
+
 	if vr.buffer == nil || len(vr.buffer) < N {
 		vr.buffer = make([]byte, N)
 	}
 
-	_, err := vr.b.File.ReadAt(vr.buffer[:N], offset)
-	return err
+	n, err := readAtContext(vr.context(), vr.b.File, vr.buffer[:N], offset)
+	if err == io.EOF {
+		if n == N {
+			err = nil
+		} else if n > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return vr.buffer[:N], err
 }
 
 func (vr *VariantReader) populateProbabilitiesLayout1(v *Variant, input []byte, expectedSize int) error {
@@ -531,3 +773,75 @@ func probabilitiesFromDecompressedLayout2(v *Variant, input []byte) (err error)
 
 	return nil
 }
+
+// variantIdentifiersFromBlock decodes the identifying fields of an
+// in-memory variant block: everything that precedes the genotype
+// probabilities. SampleProbabilities is left empty. It also returns the
+// number of bytes consumed, which is where the genotype data begins.
+func variantIdentifiersFromBlock(block []byte, layout Layout) (*Variant, int, error) {
+	v := &Variant{}
+	cursor := 0
+
+	next := func(n int) ([]byte, error) {
+		if n < 0 || cursor+n > len(block) {
+			return nil, fmt.Errorf("Variant block of %d bytes is too short to read %d bytes at position %d", len(block), n, cursor)
+		}
+		out := block[cursor : cursor+n]
+		cursor += n
+		return out, nil
+	}
+	nextString16 := func() (string, error) {
+		size, err := next(2)
+		if err != nil {
+			return "", err
+		}
+		s, err := next(int(binary.LittleEndian.Uint16(size)))
+		return string(s), err
+	}
+
+	if layout == Layout1 {
+		buf, err := next(4)
+		if err != nil {
+			return nil, cursor, err
+		}
+		v.NSamples = binary.LittleEndian.Uint32(buf)
+	}
+
+	var err error
+	if v.ID, err = nextString16(); err != nil {
+		return nil, cursor, err
+	}
+	if v.RSID, err = nextString16(); err != nil {
+		return nil, cursor, err
+	}
+	if v.Chromosome, err = nextString16(); err != nil {
+		return nil, cursor, err
+	}
+
+	buf, err := next(4)
+	if err != nil {
+		return nil, cursor, err
+	}
+	v.Position = binary.LittleEndian.Uint32(buf)
+
+	v.NAlleles = 2
+	if layout == Layout2 {
+		if buf, err = next(2); err != nil {
+			return nil, cursor, err
+		}
+		v.NAlleles = binary.LittleEndian.Uint16(buf)
+	}
+
+	for i := uint16(0); i < v.NAlleles; i++ {
+		if buf, err = next(4); err != nil {
+			return nil, cursor, err
+		}
+		allele, err := next(int(binary.LittleEndian.Uint32(buf)))
+		if err != nil {
+			return nil, cursor, err
+		}
+		v.Alleles = append(v.Alleles, Allele(allele))
+	}
+
+	return v, cursor, nil
+}
@@ -0,0 +1,117 @@
+package bgen
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+func TestVariantReaderReadsPerVariant(t *testing.T) {
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &countingReaderAt{sectionReaderAtCloser: &sectionReaderAtCloser{SectionReader: newBytesSection(data)}}
+	b, err := OpenReaderAt(src, int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, read := range []struct {
+		name string
+		fn   func(*VariantReader) *Variant
+	}{
+		{"Read", (*VariantReader).Read},
+		{"ReadMetadata", (*VariantReader).ReadMetadata},
+	} {
+		vr := b.NewVariantReader()
+		atomic.StoreInt64(&src.reads, 0)
+		var n int64
+		for v := read.fn(vr); v != nil; v = read.fn(vr) {
+			n++
+		}
+		if err := vr.Error(); err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(b.NVariants) {
+			t.Fatalf("%s: got %d variants, expected %d", read.name, n, b.NVariants)
+		}
+
+		// The first block sets the size of the prefix read for the rest
+		if reads := atomic.LoadInt64(&src.reads); reads > n+2 {
+			t.Errorf("%s: made %d reads for %d variants, expected about one each", read.name, reads, n)
+		}
+	}
+}
+
+func TestVariantReaderPastEOF(t *testing.T) {
+	data, err := os.ReadFile(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A header whose variants start beyond the end of the file
+	badStart := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(badStart, uint32(len(data)+1000))
+	badStartPath := filepath.Join(t.TempDir(), "badstart.bgen")
+	if err := os.WriteFile(badStartPath, badStart, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name string
+		open func(t *testing.T, data []byte, path string) *BGEN
+	}{
+		{"ReaderAt", func(t *testing.T, data []byte, path string) *BGEN {
+			b, err := OpenReaderAt(newBytesSection(data), int64(len(data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}},
+		{"Open", func(t *testing.T, data []byte, path string) *BGEN {
+			b, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}},
+		{"OpenMmap", func(t *testing.T, data []byte, path string) *BGEN {
+			if runtime.GOOS != "linux" {
+				t.Skip("OpenMmap is only supported on Linux")
+			}
+			b, err := OpenMmap(path, AccessNormal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return b
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := test.open(t, data, exampleBGENPath)
+			defer b.Close()
+
+			vr := b.NewVariantReader()
+			if v := vr.ReadAt(int64(len(data))); v != nil || vr.Error() != nil {
+				t.Errorf("Reading at the end of the file got %v and error %v, expected neither", v, vr.Error())
+			}
+			vr = b.NewVariantReader()
+			if v := vr.ReadAt(int64(len(data)) + 100); v != nil || !errors.Is(vr.Error(), io.ErrUnexpectedEOF) {
+				t.Errorf("Reading past the end of the file got %v and error %v, expected io.ErrUnexpectedEOF", v, vr.Error())
+			}
+
+			bad := test.open(t, badStart, badStartPath)
+			defer bad.Close()
+			vr = bad.NewVariantReader()
+			if v := vr.Read(); v != nil || !errors.Is(vr.Error(), io.ErrUnexpectedEOF) {
+				t.Errorf("Reading variants that start past the end of the file got %v and error %v, expected io.ErrUnexpectedEOF", v, vr.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package bgen
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/carbocation/pfx"
+)
+
+// WriteVCFHeader writes a VCF 4.2 header declaring the GP and DS FORMAT
+// fields used by WriteVCFRecord, followed by the column header line.
+func WriteVCFHeader(w io.Writer, samples []Sample) error {
+	header := []string{
+		"##fileformat=VCFv4.2",
+		"##source=github.com/carbocation/bgen",
+		`##FORMAT=<ID=GP,Number=G,Type=Float,Description="Genotype probabilities">`,
+		`##FORMAT=<ID=DS,Number=A,Type=Float,Description="Expected count of the alternate allele">`,
+	}
+
+	columns := []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO", "FORMAT"}
+	for _, s := range samples {
+		columns = append(columns, s.SampleID)
+	}
+	header = append(header, strings.Join(columns, "\t"))
+
+	_, err := io.WriteString(w, strings.Join(header, "\n")+"\n")
+	return pfx.Err(err)
+}
+
+// WriteVCFRecord writes v as a single VCF line, treating the first allele as
+// REF. Unphased variants carry GP (in BGEN order, which matches VCF order for
+// diploid samples) and, if biallelic, DS. Phased variants are written with
+// missing values, since phased probabilities are not yet supported. The
+// caller flushes bw after the last record.
+func WriteVCFRecord(bw *bufio.Writer, v *Variant) error {
+	if err := v.decoded(); err != nil {
+		return pfx.Err(err)
+	}
+
+	ref, alt := ".", "."
+	if len(v.Alleles) > 0 {
+		ref = v.Alleles[0].String()
+	}
+	if len(v.Alleles) > 1 {
+		alts := make([]string, 0, len(v.Alleles)-1)
+		for _, a := range v.Alleles[1:] {
+			alts = append(alts, a.String())
+		}
+		alt = strings.Join(alts, ",")
+	}
+
+	id := v.RSID
+	if id == "" {
+		id = v.ID
+	}
+	if id == "" {
+		id = "."
+	}
+
+	withDosage := v.NAlleles == 2 && !v.Phased
+	format := "GP"
+	if withDosage {
+		format = "GP:DS"
+	}
+
+	bw.WriteString(strings.Join([]string{v.Chromosome, strconv.FormatUint(uint64(v.Position), 10), id, ref, alt, ".", ".", ".", format}, "\t"))
+
+	for _, sp := range v.SampleProbabilities {
+		bw.WriteByte('\t')
+
+		if v.Phased || sp.Missing || len(sp.Probabilities) == 0 {
+			bw.WriteString(".")
+			if withDosage {
+				bw.WriteString(":.")
+			}
+			continue
+		}
+
+		for i, p := range genotypeProbabilities(sp, int(v.NAlleles)) {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			bw.WriteString(strconv.FormatFloat(p, 'g', 6, 64))
+		}
+
+		if withDosage {
+			bw.WriteByte(':')
+			if d := sp.dosageBiallelic(); math.IsNaN(d) {
+				bw.WriteString(".")
+			} else {
+				bw.WriteString(strconv.FormatFloat(d, 'g', 6, 64))
+			}
+		}
+	}
+
+	// Errors are sticky, so the last write reports any earlier failure
+	return pfx.Err(bw.WriteByte('\n'))
+}
+
+// genotypeProbabilities returns the probabilities of an unphased sample in
+// genotype order, without the padding that the reader inserts before the
+// final genotype for samples whose ploidy is below the variant's maximum.
+func genotypeProbabilities(sp SampleProbability, nAlleles int) []float64 {
+	nCombs := Choose(nAlleles+int(sp.Ploidy)-1, nAlleles-1)
+	if nCombs == len(sp.Probabilities) || nCombs < 1 || nCombs > len(sp.Probabilities) {
+		return sp.Probabilities
+	}
+
+	out := make([]float64, nCombs)
+	copy(out, sp.Probabilities[:nCombs-1])
+	out[nCombs-1] = sp.Probabilities[len(sp.Probabilities)-1]
+
+	return out
+}
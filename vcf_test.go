@@ -0,0 +1,41 @@
+package bgen
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestWriteVCFRecord(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+
+	for _, v := range []*Variant{
+		{RSID: "rs1", Chromosome: "1", Position: 10, NAlleles: 2, Alleles: []Allele{"A", "G"}, SampleProbabilities: []SampleProbability{
+			{Ploidy: 2, Probabilities: []float64{0, 0.5, 0.5}},
+			{Ploidy: 2, Missing: true},
+		}},
+		{ID: "v2", Chromosome: "1", Position: 20, NAlleles: 3, Alleles: []Allele{"A", "C", "G"}, SampleProbabilities: []SampleProbability{
+			{Ploidy: 2, Probabilities: []float64{1, 0, 0, 0, 0, 0}},
+			{Ploidy: 2, Missing: true},
+		}},
+	} {
+		if err := WriteVCFRecord(bw, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is flushed until the caller asks
+	if buf.Len() != 0 {
+		t.Errorf("WriteVCFRecord flushed %d bytes", buf.Len())
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "1\t10\trs1\tA\tG\t.\t.\t.\tGP:DS\t0,0.5,0.5:1.5\t.:.\n" +
+		"1\t20\tv2\tA\tC,G\t.\t.\t.\tGP\t1,0,0,0,0,0\t.\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Got\n%q\nexpected\n%q", got, want)
+	}
+}
@@ -0,0 +1,705 @@
+package bgen
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/carbocation/pfx"
+	"github.com/klauspost/compress/zstd"
+)
+
+// WriterOptions describes the BGEN file that a Writer produces.
+type WriterOptions struct {
+	Layout      Layout
+	Compression Compression
+
+	// NProbabilityBits is the number of bits used to store each probability
+	// in Layout2. If zero, 16 is used. Layout1 always uses 16 bits, scaled by
+	// 32768.
+	NProbabilityBits uint8
+
+	// SampleIDs are written to the sample identifier block. If empty, the
+	// file is written without sample IDs.
+	SampleIDs []string
+
+	// FreeData is copied into the free data area of the header block.
+	FreeData []byte
+}
+
+// Writer writes BGEN files. Variants are written in the order they are
+// received. A Writer made by NewWriter or Create fills in the variant count
+// in the header on Close; one made by NewStreamWriter never seeks, and
+// instead checks on Close that the declared count was written.
+type Writer struct {
+	w      io.Writer
+	seeker io.Seeker // Nil for a streaming Writer
+	bw     *bufio.Writer
+	closer io.Closer
+	closed bool
+
+	// offset is the number of bytes written so far, and head holds the
+	// first of them for index metadata. When recordIndex is set, rows
+	// collects the index row of each variant as it is written.
+	offset      int64
+	head        []byte
+	recordIndex bool
+	rows        []VariantIndex
+
+	// declaredVariants is the count that a streaming Writer wrote to the
+	// header up front
+	declaredVariants uint32
+
+	nSamples  uint32
+	nVariants uint32
+	opts      WriterOptions
+	maxError  float64
+
+	// Cached values
+	block   bytes.Buffer
+	probs   []byte
+	quant   []uint32
+	scratch []float64
+	zlibBuf bytes.Buffer
+	zw      *zlib.Writer
+	zstdEnc *zstd.Encoder
+}
+
+// Create creates a BGEN file at path, truncating it if it exists. Closing the
+// Writer closes the file. gs:// paths are staged in a local temporary file,
+// so that the header can be fixed up, and uploaded when the Writer is
+// closed; use CreateStream to upload as variants are written instead.
+func Create(path string, nSamples uint32, opts WriterOptions) (*Writer, error) {
+	out, err := CreateOutput(path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	w, err := NewWriter(out, nSamples, opts)
+	if err != nil {
+		out.Abort()
+		return nil, pfx.Err(err)
+	}
+	w.closer = out
+
+	return w, nil
+}
+
+// CreateStream creates a BGEN file at path with NewStreamWriter, so nVariants
+// must be declared up front. Nothing is staged: gs:// paths are written with
+// a resumable upload as variants arrive, and the object is only published if
+// Close finds that the declared number of variants was written.
+func CreateStream(path string, nSamples, nVariants uint32, opts WriterOptions) (*Writer, error) {
+	dst, err := createPath(context.Background(), path)
+	if err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	w, err := NewStreamWriter(dst, nSamples, nVariants, opts)
+	if err != nil {
+		closeOrAbort(dst)
+		return nil, pfx.Err(err)
+	}
+	w.closer = dst
+
+	return w, nil
+}
+
+// NewWriter writes the BGEN header and sample identifier block to w and
+// returns a Writer that is ready to accept variants. w must be positioned at
+// the start of the output. On Close, the Writer seeks back to record the
+// number of variants in the header.
+func NewWriter(w io.WriteSeeker, nSamples uint32, opts WriterOptions) (*Writer, error) {
+	return newWriter(w, w, nSamples, 0, opts)
+}
+
+// NewStreamWriter is like NewWriter, but never seeks, so w can be stdout, a
+// pipe or an upload. Since the header comes first, the number of variants
+// must be declared up front: writing more is an error, and Close reports an
+// error if fewer were written.
+func NewStreamWriter(w io.Writer, nSamples, nVariants uint32, opts WriterOptions) (*Writer, error) {
+	return newWriter(w, nil, nSamples, nVariants, opts)
+}
+
+// newWriterFor returns a Writer that patches the header on Close if w can
+// seek, which excludes pipes even though they are *os.File, and otherwise
+// streams with nVariants declared up front.
+func newWriterFor(w io.Writer, nSamples, nVariants uint32, opts WriterOptions) (*Writer, error) {
+	if ws, ok := w.(io.WriteSeeker); ok {
+		if _, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			return NewWriter(ws, nSamples, opts)
+		}
+	}
+
+	return NewStreamWriter(w, nSamples, nVariants, opts)
+}
+
+func newWriter(w io.Writer, seeker io.Seeker, nSamples, nVariants uint32, opts WriterOptions) (*Writer, error) {
+	if opts.NProbabilityBits == 0 {
+		opts.NProbabilityBits = 16
+	}
+	if opts.NProbabilityBits > 32 {
+		return nil, pfx.Err(fmt.Errorf("NProbabilityBits must be 1-32 inclusive, got %d", opts.NProbabilityBits))
+	}
+	if opts.Layout != Layout1 && opts.Layout != Layout2 {
+		return nil, pfx.Err(fmt.Errorf("Layout 1 and 2 are supported; layout %d is not", opts.Layout))
+	}
+	if opts.Compression > CompressionZStandard {
+		return nil, pfx.Err(fmt.Errorf("Compression 0, 1, and 2 are supported; compression %d is not", opts.Compression))
+	}
+	if opts.Layout == Layout1 && opts.Compression == CompressionZStandard {
+		return nil, pfx.Err(fmt.Errorf("Compression choice %s is not compatible with Layout %s", opts.Compression, opts.Layout))
+	}
+	if len(opts.SampleIDs) > 0 && len(opts.SampleIDs) != int(nSamples) {
+		return nil, pfx.Err(fmt.Errorf("Got %d sample IDs for %d samples", len(opts.SampleIDs), nSamples))
+	}
+
+	out := &Writer{
+		w:                w,
+		seeker:           seeker,
+		bw:               bufio.NewWriterSize(w, 1<<20),
+		nSamples:         nSamples,
+		declaredVariants: nVariants,
+		opts:             opts,
+	}
+
+	if err := out.writeHeader(); err != nil {
+		return nil, pfx.Err(err)
+	}
+
+	return out, nil
+}
+
+// NVariants returns the number of variants written so far.
+func (w *Writer) NVariants() uint32 {
+	return w.nVariants
+}
+
+// MaxProbabilityError returns the largest absolute difference, across every
+// probability encoded so far by WriteVariant, between the probability that
+// was provided and the value that was stored.
+func (w *Writer) MaxProbabilityError() float64 {
+	return w.maxError
+}
+
+func (w *Writer) writeHeader() error {
+	buf := &bytes.Buffer{}
+
+	headerLength := uint32(20 + len(w.opts.FreeData))
+
+	var sampleBlock []byte
+	if len(w.opts.SampleIDs) > 0 {
+		sb := &bytes.Buffer{}
+		putUint32(sb, 0) // Filled in below
+		putUint32(sb, w.nSamples)
+		for _, id := range w.opts.SampleIDs {
+			if err := putString16(sb, id); err != nil {
+				return pfx.Err(err)
+			}
+		}
+		sampleBlock = sb.Bytes()
+		binary.LittleEndian.PutUint32(sampleBlock, uint32(len(sampleBlock)))
+	}
+
+	putUint32(buf, headerLength+uint32(len(sampleBlock)))
+	putUint32(buf, headerLength)
+	putUint32(buf, w.declaredVariants)
+	putUint32(buf, w.nSamples)
+	buf.WriteString(MagicNumber)
+	buf.Write(w.opts.FreeData)
+	putUint32(buf, w.flags())
+	buf.Write(sampleBlock)
+
+	return w.write(buf.Bytes())
+}
+
+// write appends p to the output, keeping track of the offset and the first
+// thousand bytes.
+func (w *Writer) write(p []byte) error {
+	if _, err := w.bw.Write(p); err != nil {
+		return err
+	}
+	if n := 1000 - len(w.head); n > 0 {
+		if n > len(p) {
+			n = len(p)
+		}
+		w.head = append(w.head, p[:n]...)
+	}
+	w.offset += int64(len(p))
+
+	return nil
+}
+
+func (w *Writer) flags() uint32 {
+	var flags uint32
+
+	flags |= uint32(w.opts.Compression)
+
+	// The spec numbers layouts from 1
+	flags |= (uint32(w.opts.Layout) + 1) << 2
+
+	if len(w.opts.SampleIDs) > 0 {
+		flags |= 1 << 31
+	}
+
+	return flags
+}
+
+// writeRawVariant copies an already-encoded variant block, which must match
+// the layout, compression and sample count of the Writer.
+func (w *Writer) writeRawVariant(block []byte) error {
+	if w.seeker == nil && w.nVariants == w.declaredVariants {
+		return pfx.Err(fmt.Errorf("All %d declared variants have already been written", w.declaredVariants))
+	}
+	if w.recordIndex {
+		v, _, err := variantIdentifiersFromBlock(block, w.opts.Layout)
+		if err != nil {
+			return pfx.Err(err)
+		}
+		w.rows = append(w.rows, variantIndexFor(v, w.offset, int64(len(block))))
+	}
+	if err := w.write(block); err != nil {
+		return pfx.Err(err)
+	}
+	w.nVariants++
+
+	return nil
+}
+
+// WriteVariant encodes v and appends it to the file. v must have one
+// SampleProbability per sample. In Layout1, v must also be unphased and
+// biallelic, with every sample diploid or missing.
+func (w *Writer) WriteVariant(v *Variant) error {
+	if err := v.decoded(); err != nil {
+		return pfx.Err(err)
+	}
+	if len(v.SampleProbabilities) != int(w.nSamples) {
+		return pfx.Err(fmt.Errorf("Variant %s has %d samples, but the file has %d", v.ID, len(v.SampleProbabilities), w.nSamples))
+	}
+	if int(v.NAlleles) != len(v.Alleles) {
+		return pfx.Err(fmt.Errorf("Variant %s declares %d alleles but has %d", v.ID, v.NAlleles, len(v.Alleles)))
+	}
+
+	w.block.Reset()
+	if w.opts.Layout == Layout1 {
+		if err := checkLayout1Variant(v); err != nil {
+			return pfx.Err(err)
+		}
+		putUint32(&w.block, w.nSamples)
+	}
+	if err := w.encodeVariantIdentifiers(v); err != nil {
+		return pfx.Err(err)
+	}
+
+	var probs []byte
+	var err error
+	if w.opts.Layout == Layout1 {
+		probs, err = w.encodeProbabilitiesLayout1(v)
+	} else {
+		probs, err = w.encodeProbabilitiesLayout2(v)
+	}
+	if err != nil {
+		return pfx.Err(err)
+	}
+
+	switch {
+	case w.opts.Compression == CompressionDisabled && w.opts.Layout == Layout1:
+		// Layout1 stores uncompressed probabilities without a length, since
+		// it is always 6 bytes per sample
+		w.block.Write(probs)
+	case w.opts.Compression == CompressionDisabled:
+		putUint32(&w.block, uint32(len(probs)))
+		w.block.Write(probs)
+	default:
+		compressed, err := w.compress(probs)
+		if err != nil {
+			return pfx.Err(err)
+		}
+		if w.opts.Layout == Layout1 {
+			putUint32(&w.block, uint32(len(compressed)))
+		} else {
+			putUint32(&w.block, uint32(len(compressed)+4))
+			putUint32(&w.block, uint32(len(probs)))
+		}
+		w.block.Write(compressed)
+	}
+
+	return pfx.Err(w.writeRawVariant(w.block.Bytes()))
+}
+
+func (w *Writer) encodeVariantIdentifiers(v *Variant) error {
+	for _, s := range []string{v.ID, v.RSID, v.Chromosome} {
+		if err := putString16(&w.block, s); err != nil {
+			return err
+		}
+	}
+	putUint32(&w.block, v.Position)
+
+	// Layout1 variants are always biallelic, so the count is implied
+	if w.opts.Layout == Layout2 {
+		putUint16(&w.block, v.NAlleles)
+	}
+	for _, a := range v.Alleles {
+		putUint32(&w.block, uint32(len(a)))
+		w.block.WriteString(string(a))
+	}
+
+	return nil
+}
+
+// encodeProbabilitiesLayout2 produces the uncompressed Layout2 genotype
+// probability block for v. The returned slice is reused between calls.
+func (w *Writer) encodeProbabilitiesLayout2(v *Variant) ([]byte, error) {
+	if v.Phased {
+		return nil, fmt.Errorf("Variant %s is phased; writing phased data is not supported", v.ID)
+	}
+
+	nBits := int(w.opts.NProbabilityBits)
+	nAlleles := int(v.NAlleles)
+
+	minPloidy, maxPloidy := uint8(63), uint8(0)
+	var nValues int
+	for i, sp := range v.SampleProbabilities {
+		if sp.Ploidy > 63 {
+			return nil, fmt.Errorf("Sample %d of variant %s has ploidy %d; the maximum is 63", i, v.ID, sp.Ploidy)
+		}
+		if sp.Ploidy < minPloidy {
+			minPloidy = sp.Ploidy
+		}
+		if sp.Ploidy > maxPloidy {
+			maxPloidy = sp.Ploidy
+		}
+		nValues += Choose(nAlleles+int(sp.Ploidy)-1, nAlleles-1) - 1
+	}
+	if len(v.SampleProbabilities) == 0 {
+		minPloidy = 0
+	}
+
+	headerSize := 4 + 2 + 1 + 1 + len(v.SampleProbabilities) + 1 + 1
+	size := headerSize + (nValues*nBits+7)/8
+	if cap(w.probs) < size {
+		w.probs = make([]byte, size)
+	}
+	out := w.probs[:size]
+	for i := range out {
+		out[i] = 0
+	}
+
+	binary.LittleEndian.PutUint32(out[0:], uint32(len(v.SampleProbabilities)))
+	binary.LittleEndian.PutUint16(out[4:], v.NAlleles)
+	out[6] = minPloidy
+	out[7] = maxPloidy
+	for i, sp := range v.SampleProbabilities {
+		out[8+i] = sp.Ploidy
+		if sp.Missing || isLayout1Missing(sp) {
+			out[8+i] |= 1 << 7
+		}
+	}
+	out[headerSize-2] = 0 // Unphased
+	out[headerSize-1] = uint8(nBits)
+
+	bw := newBitWriter(out[headerSize:], nBits)
+	for i, sp := range v.SampleProbabilities {
+		nCombs := Choose(nAlleles+int(sp.Ploidy)-1, nAlleles-1)
+		if cap(w.quant) < nCombs {
+			w.quant = make([]uint32, nCombs)
+			w.scratch = make([]float64, nCombs)
+		}
+		quant := w.quant[:nCombs]
+
+		if sp.Missing || isLayout1Missing(sp) {
+			// Missing samples are written as zeroes
+			for j := 0; j < nCombs-1; j++ {
+				bw.Write(0)
+			}
+			continue
+		}
+
+		if len(sp.Probabilities) < nCombs {
+			return nil, fmt.Errorf("Sample %d of variant %s has %d probabilities, expected at least %d", i, v.ID, len(sp.Probabilities), nCombs)
+		}
+
+		// The reader places the final (implied) genotype at the end of the
+		// slice, which may be longer than nCombs for lower-ploidy samples.
+		probs := w.scratch[:nCombs]
+		copy(probs, sp.Probabilities[:nCombs-1])
+		probs[nCombs-1] = sp.Probabilities[len(sp.Probabilities)-1]
+
+		maxErr, err := quantizeProbabilities(probs, nBits, quant)
+		if err != nil {
+			return nil, fmt.Errorf("Sample %d of variant %s: %w", i, v.ID, err)
+		}
+		if maxErr > w.maxError {
+			w.maxError = maxErr
+		}
+		for _, q := range quant[:nCombs-1] {
+			bw.Write(q)
+		}
+	}
+
+	return out, nil
+}
+
+// checkLayout1Variant reports why v cannot be stored in Layout1, which only
+// holds unphased, biallelic, diploid genotypes. Missing samples are allowed
+// regardless of ploidy.
+func checkLayout1Variant(v *Variant) error {
+	if v.NAlleles != 2 {
+		return fmt.Errorf("Variant %s has %d alleles; %s only supports biallelic variants", v.ID, v.NAlleles, Layout1)
+	}
+	if v.Phased {
+		return fmt.Errorf("Variant %s is phased; %s only supports unphased variants", v.ID, Layout1)
+	}
+	for i, sp := range v.SampleProbabilities {
+		if sp.Missing || isLayout1Missing(sp) {
+			continue
+		}
+		if sp.Ploidy != 2 {
+			return fmt.Errorf("Sample %d of variant %s has ploidy %d; %s only supports diploid samples", i, v.ID, sp.Ploidy, Layout1)
+		}
+		if len(sp.Probabilities) < 3 {
+			return fmt.Errorf("Sample %d of variant %s has %d probabilities, expected 3", i, v.ID, len(sp.Probabilities))
+		}
+	}
+
+	return nil
+}
+
+// encodeProbabilitiesLayout1 produces the uncompressed Layout1 probability
+// block for v: three 16-bit values per sample, each a probability scaled by
+// 32768 and rounded, with missing samples written as zeroes. This is the
+// inverse of probabilitiesFromDecompressedLayout1. The returned slice is
+// reused between calls.
+func (w *Writer) encodeProbabilitiesLayout1(v *Variant) ([]byte, error) {
+	size := 6 * len(v.SampleProbabilities)
+	if cap(w.probs) < size {
+		w.probs = make([]byte, size)
+	}
+	out := w.probs[:size]
+
+	for i, sp := range v.SampleProbabilities {
+		sample := out[6*i : 6*i+6]
+		if sp.Missing || isLayout1Missing(sp) {
+			for j := range sample {
+				sample[j] = 0
+			}
+			continue
+		}
+
+		// The reader places the final genotype at the end of the slice
+		probs := [3]float64{sp.Probabilities[0], sp.Probabilities[1], sp.Probabilities[len(sp.Probabilities)-1]}
+		for j, p := range probs {
+			if !(p >= 0 && p <= 1) {
+				return nil, fmt.Errorf("Sample %d of variant %s has probability %v, which is outside [0, 1]", i, v.ID, p)
+			}
+			q := math.Round(p * 32768)
+			if e := math.Abs(q/32768 - p); e > w.maxError {
+				w.maxError = e
+			}
+			binary.LittleEndian.PutUint16(sample[2*j:], uint16(q))
+		}
+	}
+
+	return out, nil
+}
+
+// isLayout1Missing reports whether every probability is zero, which is how
+// Layout1 files represent a missing sample.
+func isLayout1Missing(sp SampleProbability) bool {
+	for _, p := range sp.Probabilities {
+		if p != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// quantizeProbabilities converts probabilities to nBits-bit integers that
+// sum to exactly 2^nBits-1, using the rounding algorithm recommended by the
+// BGEN spec: each scaled probability is rounded down, and then the values
+// with the largest fractional parts are rounded up until the total is
+// correct. The probabilities are normalized to sum to one first. It returns
+// the largest absolute difference between an input probability and its
+// stored representation.
+func quantizeProbabilities(probs []float64, nBits int, dst []uint32) (float64, error) {
+	var sum float64
+	for _, p := range probs {
+		if p < 0 || math.IsNaN(p) {
+			return 0, fmt.Errorf("Probability %v is not valid", p)
+		}
+		sum += p
+	}
+	if sum <= 0 {
+		return 0, fmt.Errorf("Probabilities %v sum to %v", probs, sum)
+	}
+
+	scale := float64(uint64(1)<<uint64(nBits) - 1)
+
+	type remainder struct {
+		idx  int
+		frac float64
+	}
+	fracs := make([]remainder, len(probs))
+
+	var total uint64
+	for i, p := range probs {
+		x := p / sum * scale
+		f := math.Floor(x)
+		dst[i] = uint32(f)
+		total += uint64(f)
+		fracs[i] = remainder{idx: i, frac: x - f}
+	}
+
+	sort.SliceStable(fracs, func(i, j int) bool { return fracs[i].frac > fracs[j].frac })
+	for k := 0; total < uint64(scale) && k < len(fracs); k++ {
+		dst[fracs[k].idx]++
+		total++
+	}
+
+	var maxErr float64
+	for i, p := range probs {
+		if e := math.Abs(float64(dst[i])/scale - p); e > maxErr {
+			maxErr = e
+		}
+	}
+
+	return maxErr, nil
+}
+
+func (w *Writer) compress(data []byte) ([]byte, error) {
+	switch w.opts.Compression {
+	case CompressionZLIB:
+		w.zlibBuf.Reset()
+		if w.zw == nil {
+			w.zw = zlib.NewWriter(&w.zlibBuf)
+		} else {
+			w.zw.Reset(&w.zlibBuf)
+		}
+		if _, err := w.zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.zw.Close(); err != nil {
+			return nil, err
+		}
+		return w.zlibBuf.Bytes(), nil
+	case CompressionZStandard:
+		if w.zstdEnc == nil {
+			enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			w.zstdEnc = enc
+		}
+		return w.zstdEnc.EncodeAll(data, nil), nil
+	}
+
+	return nil, fmt.Errorf("Compression choice %s is not compatible with Layout %s", w.opts.Compression, w.opts.Layout)
+}
+
+// Close flushes any buffered data, fills in the variant count in the header
+// and, if the Writer was made by Create or CreateStream, closes the file.
+// If that fails, the output is abandoned as by Abort. Closing a Writer a
+// second time, or after Abort, does nothing.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+
+	if err := w.finish(); err != nil {
+		w.Abort()
+		return pfx.Err(err)
+	}
+	w.closed = true
+
+	if w.zstdEnc != nil {
+		w.zstdEnc.Close()
+	}
+	if w.closer != nil {
+		return pfx.Err(w.closer.Close())
+	}
+
+	return nil
+}
+
+// finish flushes the output and makes its header agree with the variants
+// that were written.
+func (w *Writer) finish() error {
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+
+	if w.seeker == nil {
+		if w.nVariants != w.declaredVariants {
+			return fmt.Errorf("The header declares %d variants, but only %d were written", w.declaredVariants, w.nVariants)
+		}
+		return nil
+	}
+
+	return w.patchVariantCount()
+}
+
+// Abort abandons the output of a Writer made by Create or CreateStream
+// without finishing it. Uploads to gs:// paths are cancelled rather than
+// published, and staged temporary files are removed; local files are closed
+// as they are. Callers should Abort on error paths, and it is safe to defer
+// Abort alongside a later Close, since whichever comes second does nothing.
+func (w *Writer) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	if w.zstdEnc != nil {
+		w.zstdEnc.Close()
+	}
+	if w.closer != nil {
+		closeOrAbort(w.closer)
+	}
+}
+
+// patchVariantCount seeks back to record the number of variants written in
+// the header, and then returns to the end of the output.
+func (w *Writer) patchVariantCount() error {
+	if _, err := w.seeker.Seek(offsetNumberVariants, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, w.nVariants)
+	if len(w.head) >= offsetNumberVariants+4 {
+		copy(w.head[offsetNumberVariants:], buf)
+	}
+	if _, err := w.w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.seeker.Seek(0, io.SeekEnd)
+	return err
+}
+
+func putUint16(buf *bytes.Buffer, v uint16) {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	buf.Write(b[:])
+}
+
+func putUint32(buf *bytes.Buffer, v uint32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	buf.Write(b[:])
+}
+
+func putString16(buf *bytes.Buffer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("String of length %d is too long to store with a 2-byte length", len(s))
+	}
+	putUint16(buf, uint16(len(s)))
+	buf.WriteString(s)
+
+	return nil
+}
@@ -0,0 +1,470 @@
+package bgen
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeExampleCopy re-encodes the example file with opts, prefixing each
+// sample ID with idPrefix, and returns the path of the new file.
+func writeExampleCopy(t *testing.T, opts WriterOptions, idPrefix string) string {
+	t.Helper()
+
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	samples, err := ReadSamples(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range samples {
+		opts.SampleIDs = append(opts.SampleIDs, idPrefix+s.SampleID)
+	}
+
+	path := filepath.Join(t.TempDir(), "copy.bgen")
+	w, err := Create(path, b.NSamples, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vr := b.NewVariantReader()
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		if err := w.WriteVariant(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vr.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// compareProbabilities checks that every variant in got matches want to
+// within tolerance.
+func compareProbabilities(t *testing.T, want, got *BGEN, tolerance float64) {
+	t.Helper()
+
+	wr, gr := want.NewVariantReader(), got.NewVariantReader()
+	for {
+		wv, gv := wr.Read(), gr.Read()
+		if wv == nil || gv == nil {
+			if wv != gv {
+				t.Fatalf("Files have different numbers of variants")
+			}
+			break
+		}
+		if err := sameVariant(wv, gv); err != nil {
+			t.Fatal(err)
+		}
+		for i, wsp := range wv.SampleProbabilities {
+			gsp := gv.SampleProbabilities[i]
+
+			// Layout1 has no missing flag, and marks missing samples with
+			// probabilities that are all zero
+			wMissing, gMissing := wsp.Missing || isLayout1Missing(wsp), gsp.Missing || isLayout1Missing(gsp)
+			if wMissing != gMissing || wsp.Ploidy != gsp.Ploidy {
+				t.Fatalf("Variant %s sample %d: got %+v, expected %+v", wv.ID, i, gsp, wsp)
+			}
+			if wMissing {
+				continue
+			}
+			for j, p := range wsp.Probabilities {
+				if math.Abs(p-gsp.Probabilities[j]) > tolerance {
+					t.Fatalf("Variant %s sample %d: got %v, expected %v", wv.ID, i, gsp.Probabilities, wsp.Probabilities)
+				}
+			}
+		}
+	}
+	if wr.Error() != nil || gr.Error() != nil {
+		t.Fatal(wr.Error(), gr.Error())
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, comp := range []Compression{CompressionDisabled, CompressionZLIB, CompressionZStandard} {
+		for _, bits := range []uint8{3, 8, 16, 32} {
+			path := writeExampleCopy(t, WriterOptions{Layout: Layout2, Compression: comp, NProbabilityBits: bits}, "")
+
+			want, err := Open(exampleBGENPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.NVariants != want.NVariants || got.NSamples != want.NSamples || got.FlagCompression != comp {
+				t.Errorf("Got header %+v, expected counts from %+v", got, want)
+			}
+
+			compareProbabilities(t, want, got, 1/float64(uint64(1)<<bits-1))
+
+			want.Close()
+			got.Close()
+		}
+	}
+}
+
+func TestQuantizeProbabilitiesSumsToOne(t *testing.T) {
+	probs := []float64{1.0 / 3, 1.0 / 3, 1.0 / 3}
+	dst := make([]uint32, 3)
+	for bits := 1; bits <= 32; bits++ {
+		if _, err := quantizeProbabilities(probs, bits, dst); err != nil {
+			t.Fatal(err)
+		}
+		var sum uint64
+		for _, v := range dst {
+			sum += uint64(v)
+		}
+		if sum != uint64(1)<<bits-1 {
+			t.Errorf("%d bits: quantized values %v sum to %d", bits, dst, sum)
+		}
+	}
+}
+
+func TestConcatenate(t *testing.T) {
+	a, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	path := filepath.Join(t.TempDir(), "cat.bgen")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Concatenate(f, a, b); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if out.NVariants != 2*a.NVariants {
+		t.Errorf("Got %d variants, expected %d", out.NVariants, 2*a.NVariants)
+	}
+
+	vr := out.NewVariantReader()
+	var n uint32
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		n++
+	}
+	if vr.Error() != nil {
+		t.Fatal(vr.Error())
+	}
+	if n != out.NVariants {
+		t.Errorf("Read %d variants, header says %d", n, out.NVariants)
+	}
+}
+
+func TestMergeSamples(t *testing.T) {
+	opts := WriterOptions{Layout: Layout2, Compression: CompressionZLIB, NProbabilityBits: 16}
+	pathA := writeExampleCopy(t, opts, "a_")
+	pathB := writeExampleCopy(t, opts, "b_")
+
+	a, err := Open(pathA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(pathB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	path := filepath.Join(t.TempDir(), "merged.bgen")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := MergeSamples(f, opts, a, b); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	if out.NSamples != a.NSamples+b.NSamples {
+		t.Errorf("Got %d samples, expected %d", out.NSamples, a.NSamples+b.NSamples)
+	}
+	samples, err := ReadSamples(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samples[a.NSamples].SampleID[:2] != "b_" {
+		t.Errorf("Sample %d is %s, expected it to come from the second file", a.NSamples, samples[a.NSamples].SampleID)
+	}
+
+	// Merging a file with itself must fail because the samples overlap
+	f2, err := os.Create(filepath.Join(t.TempDir(), "dup.bgen"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+	if err := MergeSamples(f2, opts, a, a); err == nil {
+		t.Errorf("Expected an error when merging overlapping samples")
+	}
+
+	// Merging a file without sample IDs would leave some samples unnamed
+	noIDsPath := filepath.Join(t.TempDir(), "noids.bgen")
+	w, err := Create(noIDsPath, 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	noIDs, err := Open(noIDsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer noIDs.Close()
+	if err := MergeSamples(io.Discard, opts, a, noIDs); err == nil {
+		t.Errorf("Expected an error when only some inputs have sample IDs")
+	}
+
+	// Phased inputs must not be silently re-encoded as unphased
+	phasedA, err := Open(writePhasedExample(t, []string{"a"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer phasedA.Close()
+	if v := phasedA.NewVariantReader().Read(); v == nil || !v.Phased {
+		t.Fatalf("Expected the example to be phased, got %+v", v)
+	}
+	phasedB, err := Open(writePhasedExample(t, []string{"b"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer phasedB.Close()
+	if err := MergeSamples(io.Discard, opts, phasedA, phasedB); err == nil || !strings.Contains(err.Error(), "phased") {
+		t.Errorf("Expected an error merging phased variants, got %v", err)
+	}
+}
+
+// writePhasedExample writes a file of one diploid, biallelic variant whose
+// genotypes are marked phased. The writer does not support phased data, so
+// the variant is written unphased and its flag is set afterwards; with two
+// alleles and ploidy two, both encodings have two probabilities per sample.
+func writePhasedExample(t *testing.T, sampleIDs []string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "phased.bgen")
+	w, err := Create(path, uint32(len(sampleIDs)), WriterOptions{Layout: Layout2, Compression: CompressionDisabled, NProbabilityBits: 8, SampleIDs: sampleIDs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Variant{ID: "p", RSID: "rs1", Chromosome: "1", Position: 1, NAlleles: 2, Alleles: []Allele{"A", "G"}}
+	for range sampleIDs {
+		v.SampleProbabilities = append(v.SampleProbabilities, SampleProbability{Ploidy: 2, Probabilities: []float64{1, 0, 0}})
+	}
+	if err := w.WriteVariant(v); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The genotype block ends the file with the phased flag, the bit depth
+	// and two bytes of probabilities per sample
+	data[len(data)-2-2*len(sampleIDs)] = 1
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestTranscode(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	path := filepath.Join(t.TempDir(), "8bit.bgen")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	stats, err := Transcode(b, f, WriterOptions{Layout: Layout2, Compression: CompressionZStandard, NProbabilityBits: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NVariants != b.NVariants {
+		t.Errorf("Transcoded %d variants, expected %d", stats.NVariants, b.NVariants)
+	}
+	if stats.MaxProbabilityError <= 0 || stats.MaxProbabilityError > 1/255.0 {
+		t.Errorf("Max error %g is outside (0, 1/255]", stats.MaxProbabilityError)
+	}
+
+	out, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if out.FlagCompression != CompressionZStandard {
+		t.Errorf("Got compression %s", out.FlagCompression)
+	}
+
+	vr := out.NewVariantReader()
+	for v := vr.Read(); v != nil; v = vr.Read() {
+		for _, sp := range v.SampleProbabilities {
+			if sp.Missing {
+				continue
+			}
+			var sum float64
+			for _, p := range sp.Probabilities {
+				sum += p * 255
+			}
+			if math.Round(sum) != 255 || math.Abs(sum-255) > 1e-9 {
+				t.Fatalf("Variant %s: probabilities %v do not sum to one", v.ID, sp.Probabilities)
+			}
+		}
+	}
+	if vr.Error() != nil {
+		t.Fatal(vr.Error())
+	}
+
+	compareProbabilities(t, b, out, stats.MaxProbabilityError+1e-12)
+}
+
+func TestWriterLayout1(t *testing.T) {
+	for _, comp := range []Compression{CompressionDisabled, CompressionZLIB} {
+		path := writeExampleCopy(t, WriterOptions{Layout: Layout1, Compression: comp}, "")
+
+		want, err := Open(exampleBGENPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.FlagLayout != Layout1 || got.FlagCompression != comp || got.NVariants != want.NVariants {
+			t.Errorf("Got header %+v", got)
+		}
+		compareProbabilities(t, want, got, 0.5/32768)
+
+		// Layout1 files can be re-encoded as Layout1 losslessly
+		w, err := Create(filepath.Join(t.TempDir(), "again.bgen"), got.NSamples, WriterOptions{Layout: Layout1, Compression: comp})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vr := got.NewVariantReader()
+		for v := vr.Read(); v != nil; v = vr.Read() {
+			if err := w.WriteVariant(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if w.MaxProbabilityError() != 0 {
+			t.Errorf("Re-encoding Layout1 introduced an error of %g", w.MaxProbabilityError())
+		}
+
+		want.Close()
+		got.Close()
+	}
+}
+
+func TestWriterLayout1Rejects(t *testing.T) {
+	diploid := SampleProbability{Ploidy: 2, Probabilities: []float64{0, 1, 0}}
+
+	for name, v := range map[string]*Variant{
+		"multi-allelic": {ID: "a", NAlleles: 3, Alleles: []Allele{"A", "C", "G"}, SampleProbabilities: []SampleProbability{diploid}},
+		"phased":        {ID: "b", NAlleles: 2, Alleles: []Allele{"A", "C"}, Phased: true, SampleProbabilities: []SampleProbability{diploid}},
+		"haploid":       {ID: "c", NAlleles: 2, Alleles: []Allele{"A", "C"}, SampleProbabilities: []SampleProbability{{Ploidy: 1, Probabilities: []float64{0, 1}}}},
+	} {
+		w, err := Create(filepath.Join(t.TempDir(), "rejects.bgen"), 1, WriterOptions{Layout: Layout1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteVariant(v); err == nil || !strings.Contains(err.Error(), "Layout1") {
+			t.Errorf("%s: expected an error naming Layout1, got %v", name, err)
+		}
+		w.Close()
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+	b, err := Open(exampleBGENPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// A bytes.Buffer cannot seek, so Transcode has to stream
+	var buf bytes.Buffer
+	if _, err := Transcode(b, &buf, WriterOptions{Layout: Layout2, Compression: CompressionZLIB, NProbabilityBits: 16}); err != nil {
+		t.Fatal(err)
+	}
+	out, err := OpenReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.NVariants != b.NVariants {
+		t.Errorf("Header declares %d variants, expected %d", out.NVariants, b.NVariants)
+	}
+	compareProbabilities(t, b, out, 1/65535.0)
+
+	writeN := func(declared, n int) (writeErr, closeErr error) {
+		w, err := NewStreamWriter(io.Discard, b.NSamples, uint32(declared), WriterOptions{Layout: Layout2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vr := b.NewVariantReader()
+		for i := 0; i < n; i++ {
+			if err := w.WriteVariant(vr.Read()); err != nil {
+				return err, w.Close()
+			}
+		}
+		return nil, w.Close()
+	}
+
+	if writeErr, closeErr := writeN(3, 3); writeErr != nil || closeErr != nil {
+		t.Errorf("Writing the declared count failed: %v, %v", writeErr, closeErr)
+	}
+	if writeErr, closeErr := writeN(3, 2); writeErr != nil || closeErr == nil {
+		t.Errorf("Expected Close to fail after writing too few variants, got %v, %v", writeErr, closeErr)
+	}
+	if writeErr, _ := writeN(3, 4); writeErr == nil {
+		t.Errorf("Expected an error when writing more variants than declared")
+	}
+}